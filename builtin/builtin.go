@@ -0,0 +1,153 @@
+// Package builtin 维护脚本中可以调用的内置数学函数。
+//
+// 词法分析器、语法分析器和解释器都从同一个 Registry 中查找函数，
+// 嵌入本语言的 Go 程序只需调用 Register 即可添加新的函数：
+//
+//	builtin.Register("GAMMA", math.Gamma)
+package builtin
+
+import (
+	"compilers/token"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Variadic 作为 Function.Arity 时表示函数接受一个或多个参数
+const Variadic = -1
+
+// Function 描述一个内置函数
+type Function struct {
+	Name   string                       // 函数名，统一为大写
+	Arity  int                          // 参数个数，Variadic 表示一个或多个
+	Impl   func(args []float64) float64 // 函数实现，参数个数已经过检查
+	Domain func(args []float64) bool    // 参数是否在定义域内，nil 表示处处有定义
+	Doc    string                       // 简短说明，包括定义域外的行为
+}
+
+// Call 检查参数个数并调用函数；参数不在定义域内时结果为 NaN，
+// 绘图时 NaN 对应的点会被跳过
+func (f *Function) Call(args []float64) (float64, error) {
+	if err := f.CheckArity(len(args)); err != nil {
+		return 0, err
+	}
+	if f.Domain != nil && !f.Domain(args) {
+		return math.NaN(), nil
+	}
+	return f.Impl(args), nil
+}
+
+// CheckArity 检查参数个数是否符合函数的要求
+func (f *Function) CheckArity(n int) error {
+	switch {
+	case f.Arity == Variadic && n == 0:
+		return fmt.Errorf("Function %s expects at least 1 argument, got 0", f.Name)
+	case f.Arity != Variadic && n != f.Arity:
+		return fmt.Errorf("Function %s expects %d argument(s), got %d", f.Name, f.Arity, n)
+	}
+	return nil
+}
+
+// Registry 是内置函数表，可以被多个 goroutine 同时使用。
+// 词法分析、语义检查和执行都只查找 Default，新的函数通过 Register 和 RegisterFunction 登记在其中
+type Registry struct {
+	mu    sync.RWMutex
+	funcs map[string]*Function
+}
+
+// newRegistry 创建一个空的函数表
+func newRegistry() *Registry {
+	return &Registry{funcs: make(map[string]*Function)}
+}
+
+// Register 登记一个单参数函数，例如 Register("GAMMA", math.Gamma)
+func (r *Registry) Register(name string, fn func(float64) float64) {
+	r.RegisterFunction(Function{
+		Name:  name,
+		Arity: 1,
+		Impl:  func(args []float64) float64 { return fn(args[0]) },
+	})
+}
+
+// RegisterFunction 登记一个函数。名字不是合法标识符、是保留字或常量，或者已经登记过时 panic
+func (r *Registry) RegisterFunction(f Function) {
+	f.Name = strings.ToUpper(f.Name)
+	if !isIdentifier(f.Name) {
+		panic(fmt.Sprintf("builtin: invalid function name %q", f.Name))
+	}
+	if _, ok := token.Keyword(f.Name); ok {
+		// 词法分析器把保留字识别为关键字，这样的函数永远无法调用
+		panic(fmt.Sprintf("builtin: function name %s is reserved", f.Name))
+	}
+	if f.Impl == nil {
+		panic(fmt.Sprintf("builtin: function %s has no implementation", f.Name))
+	}
+	if f.Arity < 0 && f.Arity != Variadic {
+		panic(fmt.Sprintf("builtin: function %s has invalid arity %d", f.Name, f.Arity))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.funcs[f.Name]; ok {
+		panic(fmt.Sprintf("builtin: function %s registered twice", f.Name))
+	}
+	r.funcs[f.Name] = &f
+}
+
+// Lookup 按名字查找函数
+func (r *Registry) Lookup(name string) (*Function, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	f, ok := r.funcs[name]
+	return f, ok
+}
+
+// Names 返回按字母排序的全部函数名
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.funcs))
+	for name := range r.funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isIdentifier 判断名字能否被词法分析器识别为一个标识符
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, ch := range name {
+		if !unicode.IsLetter(ch) && ch != '_' && (i == 0 || !unicode.IsDigit(ch)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Default 是默认的函数表，预先登记了标准数学函数
+var Default = newRegistry()
+
+// Register 在默认函数表中登记一个单参数函数
+func Register(name string, fn func(float64) float64) {
+	Default.Register(name, fn)
+}
+
+// RegisterFunction 在默认函数表中登记一个函数
+func RegisterFunction(f Function) {
+	Default.RegisterFunction(f)
+}
+
+// Lookup 在默认函数表中查找函数
+func Lookup(name string) (*Function, bool) {
+	return Default.Lookup(name)
+}
+
+func init() {
+	registerStandard(Default)
+}
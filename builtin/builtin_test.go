@@ -0,0 +1,114 @@
+package builtin_test
+
+import (
+	"compilers/builtin"
+	"compilers/lexer"
+	"compilers/parser"
+	"compilers/token"
+	"math"
+	"testing"
+)
+
+func TestCall(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []float64
+		expected float64
+		err      bool
+	}{
+		{"SIN", []float64{0}, 0, false},
+		{"SQRT", []float64{9}, 3, false},
+		{"SQRT", []float64{-1}, math.NaN(), false},
+		{"LN", []float64{0}, math.NaN(), false},
+		{"ASIN", []float64{1}, math.Pi / 2, false},
+		{"ACOS", []float64{1.5}, math.NaN(), false},
+		{"ATAN2", []float64{1, -1}, 3 * math.Pi / 4, false},
+		{"TANH", []float64{0}, 0, false},
+		{"ABS", []float64{-2}, 2, false},
+		{"SIGN", []float64{-0.5}, -1, false},
+		{"SIGN", []float64{0}, 0, false},
+		{"FLOOR", []float64{-1.5}, -2, false},
+		{"CEIL", []float64{-1.5}, -1, false},
+		{"ROUND", []float64{2.5}, 3, false},
+		{"MOD", []float64{-1, 3}, 2, false},
+		{"MOD", []float64{5, -3}, -1, false},
+		{"MOD", []float64{1, 0}, math.NaN(), false},
+		{"MIN", []float64{3, -1, 2}, -1, false},
+		{"MAX", []float64{3}, 3, false},
+		{"MAX", nil, 0, true},
+		{"LOG10", []float64{1000}, 3, false},
+		{"LOG2", []float64{-8}, math.NaN(), false},
+		{"POW", []float64{2, 10}, 1024, false},
+		{"POW", []float64{-8, 1.0 / 3}, math.NaN(), false},
+		{"HYPOT", []float64{3, 4}, 5, false},
+		{"COS", []float64{1, 2}, 0, true},
+		{"EXP", nil, 0, true},
+	}
+
+	for _, tt := range tests {
+		fn, ok := builtin.Lookup(tt.name)
+		if !ok {
+			t.Fatalf("function %s is not registered", tt.name)
+		}
+		got, err := fn.Call(tt.args)
+		if (err != nil) != tt.err {
+			t.Errorf("%s%v: expected error %v, but got %v", tt.name, tt.args, tt.err, err)
+			continue
+		}
+		if err == nil && !(got == tt.expected || math.IsNaN(got) && math.IsNaN(tt.expected)) {
+			t.Errorf("%s%v: expected %v, but got %v", tt.name, tt.args, tt.expected, got)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	builtin.Register("gamma", math.Gamma)
+
+	tok := lexer.New("GAMMA").NextToken()
+	if tok.Type != token.BUILTIN {
+		t.Fatalf("expected GAMMA to be lexed as %s, but got %s", token.BUILTIN, tok.Type)
+	}
+
+	statements, diagnostics := parser.New(lexer.New("x = GAMMA(5);")).ParseProgram()
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	call, ok := statements[0].(*parser.AssignmentStatement).Value.(*parser.FunctionCallExpression)
+	if !ok || call.Name != "GAMMA" {
+		t.Fatalf("expected a call to GAMMA, but got %#v", statements[0])
+	}
+
+	fn, ok := builtin.Lookup(call.Name)
+	if !ok {
+		t.Fatalf("GAMMA is not registered")
+	}
+	got, err := fn.Call([]float64{5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 24 {
+		t.Errorf("expected GAMMA(5) = 24, but got %v", got)
+	}
+}
+
+func TestRegisterInvalid(t *testing.T) {
+	tests := []builtin.Function{
+		{Name: "SIN", Arity: 1, Impl: func([]float64) float64 { return 0 }},
+		{Name: "2PI", Arity: 1, Impl: func([]float64) float64 { return 0 }},
+		{Name: "NOIMPL", Arity: 1},
+		// 保留字和常量会被识别为关键字，这样的函数无法调用
+		{Name: "STEP", Arity: 1, Impl: func([]float64) float64 { return 0 }},
+		{Name: "draw", Arity: 1, Impl: func([]float64) float64 { return 0 }},
+		{Name: "PI", Arity: 0, Impl: func([]float64) float64 { return 0 }},
+	}
+	for _, f := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected registering %s to panic", f.Name)
+				}
+			}()
+			builtin.RegisterFunction(f)
+		}()
+	}
+}
@@ -0,0 +1,108 @@
+package builtin
+
+import "math"
+
+// registerStandard 登记标准数学函数。定义域之外的参数得到 NaN，
+// 结果溢出时得到 ±Inf，这两种点在绘图时都会被跳过
+func registerStandard(r *Registry) {
+	unary := func(name string, fn func(float64) float64, domain func(x float64) bool, doc string) {
+		f := Function{
+			Name:  name,
+			Arity: 1,
+			Impl:  func(args []float64) float64 { return fn(args[0]) },
+			Doc:   doc,
+		}
+		if domain != nil {
+			f.Domain = func(args []float64) bool { return domain(args[0]) }
+		}
+		r.RegisterFunction(f)
+	}
+	binary := func(name string, fn func(x, y float64) float64, domain func(x, y float64) bool, doc string) {
+		f := Function{
+			Name:  name,
+			Arity: 2,
+			Impl:  func(args []float64) float64 { return fn(args[0], args[1]) },
+			Doc:   doc,
+		}
+		if domain != nil {
+			f.Domain = func(args []float64) bool { return domain(args[0], args[1]) }
+		}
+		r.RegisterFunction(f)
+	}
+	positive := func(x float64) bool { return x > 0 }
+	unit := func(x float64) bool { return x >= -1 && x <= 1 }
+
+	// 三角函数与反三角函数
+	unary("SIN", math.Sin, nil, "SIN(x) 正弦，x 为弧度")
+	unary("COS", math.Cos, nil, "COS(x) 余弦，x 为弧度")
+	unary("TAN", math.Tan, nil, "TAN(x) 正切，x 为弧度，在渐近线附近趋于无穷")
+	unary("ASIN", math.Asin, unit, "ASIN(x) 反正弦，结果在 [-PI/2, PI/2]，|x| > 1 时为 NaN")
+	unary("ACOS", math.Acos, unit, "ACOS(x) 反余弦，结果在 [0, PI]，|x| > 1 时为 NaN")
+	unary("ATAN", math.Atan, nil, "ATAN(x) 反正切，结果在 (-PI/2, PI/2)")
+	binary("ATAN2", math.Atan2, nil, "ATAN2(y, x) 点 (x, y) 的极角，结果在 [-PI, PI]，ATAN2(0, 0) = 0")
+
+	// 双曲函数
+	unary("SINH", math.Sinh, nil, "SINH(x) 双曲正弦")
+	unary("COSH", math.Cosh, nil, "COSH(x) 双曲余弦")
+	unary("TANH", math.Tanh, nil, "TANH(x) 双曲正切，结果在 (-1, 1)")
+
+	// 指数与对数
+	unary("SQRT", math.Sqrt, func(x float64) bool { return x >= 0 }, "SQRT(x) 平方根，x < 0 时为 NaN")
+	unary("EXP", math.Exp, nil, "EXP(x) 自然指数 e**x")
+	unary("LN", math.Log, positive, "LN(x) 自然对数，x <= 0 时为 NaN")
+	unary("LOG10", math.Log10, positive, "LOG10(x) 常用对数，x <= 0 时为 NaN")
+	unary("LOG2", math.Log2, positive, "LOG2(x) 以 2 为底的对数，x <= 0 时为 NaN")
+	binary("POW", math.Pow, nil, "POW(x, y) 即 x**y，负数的非整数次幂为 NaN")
+	binary("HYPOT", math.Hypot, nil, "HYPOT(x, y) 即 SQRT(x*x + y*y)，不会中途溢出")
+
+	// 取整、符号与取模
+	unary("ABS", math.Abs, nil, "ABS(x) 绝对值")
+	unary("SIGN", sign, nil, "SIGN(x) 符号，x 为正、零、负时分别为 1、0、-1")
+	unary("FLOOR", math.Floor, nil, "FLOOR(x) 不大于 x 的最大整数")
+	unary("CEIL", math.Ceil, nil, "CEIL(x) 不小于 x 的最小整数")
+	unary("ROUND", math.Round, nil, "ROUND(x) 四舍五入，.5 远离零取整")
+	binary("MOD", mod, func(x, y float64) bool { return y != 0 }, "MOD(x, y) 取模，结果与 y 同号，适合生成锯齿波；y = 0 时为 NaN")
+
+	// 可变参数
+	r.RegisterFunction(Function{
+		Name:  "MIN",
+		Arity: Variadic,
+		Impl:  func(args []float64) float64 { return fold(args, math.Min) },
+		Doc:   "MIN(x, ...) 参数中的最小值，任一参数为 NaN 时为 NaN",
+	})
+	r.RegisterFunction(Function{
+		Name:  "MAX",
+		Arity: Variadic,
+		Impl:  func(args []float64) float64 { return fold(args, math.Max) },
+		Doc:   "MAX(x, ...) 参数中的最大值，任一参数为 NaN 时为 NaN",
+	})
+}
+
+// sign 返回 x 的符号，NaN 保持为 NaN
+func sign(x float64) float64 {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return x // 0、-0 或 NaN
+}
+
+// mod 计算向下取整的模，结果与 y 同号
+func mod(x, y float64) float64 {
+	m := math.Mod(x, y)
+	if m != 0 && (m < 0) != (y < 0) {
+		m += y
+	}
+	return m
+}
+
+// fold 依次用 fn 合并全部参数
+func fold(args []float64, fn func(x, y float64) float64) float64 {
+	result := args[0]
+	for _, arg := range args[1:] {
+		result = fn(result, arg)
+	}
+	return result
+}
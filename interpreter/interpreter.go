@@ -1,159 +1,652 @@
 package interpreter
 
 import (
+	"compilers/builtin"
 	"compilers/parser"
+	"compilers/render"
 	"compilers/semantic"
 	"compilers/token"
+	"context"
 	"fmt"
+	"io"
+	"maps"
 	"math"
-	"strconv"
+	"os"
+	"slices"
+	"strings"
 )
 
 // Interpreter 解释器结构体，负责执行解析的语法树
+//
+// 一个解释器实例对应一次执行，所有 DRAW 语句画在同一张画布上。
+// 执行 OUTPUT IS "文件名" 时把当时的画布写入该文件；程序中没有执行过 OUTPUT 语句，
+// 或者最后一次 OUTPUT 之后又画了内容时，整张画布在程序正常结束后写入 Output。图像格式由文件扩展名决定，
+// Format 不为空时 Output 改用 Format 指定的格式。图像都经过 Sink 保存，
+// 执行过程的信息写入 Log，执行所用的资源受 Limits 限制。
+//
+// 每个解释器实例有自己的变量、画布和状态，不同的实例可以在多个 goroutine 中同时执行，
+// 只要它们不共用同一个 Sink 或 Log；一个实例只能由一个 goroutine 执行一次
 type Interpreter struct {
-	state  *semantic.State
-	parser *parser.Parser
+	Output    string             // 默认的输出文件，为空时不输出
+	Format    render.Format      // Output 的图像格式，为空时由扩展名决定
+	Limits    Limits             // 执行的资源限制，默认只限制函数调用的嵌套深度
+	Width     int                // 画布宽度，单位为像素，为零时使用 semantic.CanvasWidth
+	Height    int                // 画布高度，单位为像素，为零时使用 semantic.CanvasHeight
+	Variables map[string]float64 // 执行之前定义的全局变量，例如嵌入程序时注入的参数
+	Sink      Sink               // 保存图像，NewInterpreter 设为 FileSink
+	Log       io.Writer          // 执行过程的信息，NewInterpreter 设为 os.Stdout，为 nil 时不输出
+
+	state      *semantic.State
+	parser     *parser.Parser
+	statements []parser.Statement                     // 已经检查过的程序，见 NewProgramInterpreter
+	loopVars   map[string]token.Pos                   // 已结束的循环变量及其 FOR 语句位置
+	functions  map[string]*parser.FunctionDeclaration // 用户自定义函数
+	callDepth  int                                    // 当前用户函数调用的嵌套深度
+	written    int                                    // 上一次 OUTPUT 语句写出时显示列表中的操作数
+
+	ctx        context.Context // 本次执行的 context，由 Interpret 设置
+	samples    int             // 已经计算的采样点数
+	iterations int             // FOR 循环体已经执行的次数
+}
+
+// DefaultOutput 是命令行没有指定输出文件时使用的文件名
+const DefaultOutput = "output.png"
+
+// RuntimeError 是执行期间发生的错误
+type RuntimeError struct {
+	Stmt parser.Statement // 出错时正在执行的最内层语句
+	Pos  token.Pos        // 出错的位置，例如未定义变量出现的位置
+	Msg  string
+	Err  error // 导致错误的原因，例如 ErrLimit 或者 context.Canceled，可以为 nil
 }
 
-// NewInterpreter 创建一个新的解释器实例
+// Error 以 file:line:col: msg 的形式返回错误信息，没有位置时只返回 msg
+func (e *RuntimeError) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Msg
+	}
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// Unwrap 返回 Err，使 errors.Is(err, ErrLimit) 等判断可用
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// errorf 创建一个 RuntimeError，所属的语句由 executeStatement 补上
+func errorf(pos token.Pos, format string, args ...interface{}) error {
+	return &RuntimeError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// NewInterpreter 创建一个新的解释器实例，执行时从 p 解析程序
 func NewInterpreter(p *parser.Parser) *Interpreter {
+	i := NewProgramInterpreter(nil)
+	i.parser = p
+	return i
+}
+
+// NewProgramInterpreter 创建一个执行 statements 的解释器实例。statements 应当已经通过
+// semantic.Check 的检查 (注入的变量作为 predeclared)；执行不会修改 statements，
+// 同一个程序可以由多个解释器同时执行
+func NewProgramInterpreter(statements []parser.Statement) *Interpreter {
 	return &Interpreter{
-		state:  semantic.NewState(),
-		parser: p,
+		Sink:       FileSink{},
+		Log:        os.Stdout,
+		state:      semantic.NewState(),
+		statements: statements,
+		loopVars:   make(map[string]token.Pos),
+		functions:  make(map[string]*parser.FunctionDeclaration),
 	}
 }
 
-// Interpret 执行程序
-func (i *Interpreter) Interpret() {
-	statements := i.parser.ParseProgram()
+// Sink 保存解释器输出的图像：OUTPUT 语句写出的快照和程序结束时写入 Output 的图像。
+// list 在 Save 返回之后还会继续画上新的内容，需要保留时应当复制或者立即编码
+type Sink interface {
+	Save(path string, format render.Format, list *render.DisplayList) error
+}
+
+// FileSink 把图像写入文件
+type FileSink struct{}
+
+func (FileSink) Save(path string, format render.Format, list *render.DisplayList) error {
+	return list.WriteFile(path, format)
+}
+
+// DisplayList 返回程序到目前为止画出的内容
+func (i *Interpreter) DisplayList() *render.DisplayList {
+	return i.state.DisplayList()
+}
+
+// Interpret 执行程序。若存在语法错误或语义错误则不执行任何语句，
+// 返回包含全部诊断信息的 parser.ErrorList；执行中出错、超出 Limits 或者 ctx 被取消时
+// 停止执行并返回 *RuntimeError
+func (i *Interpreter) Interpret(ctx context.Context) error {
+	statements := i.statements
+	if i.parser != nil {
+		var diagnostics []parser.Diagnostic
+		statements, diagnostics = i.parser.ParseProgram()
+		if len(diagnostics) > 0 {
+			return parser.ErrorList(diagnostics)
+		}
+		if diagnostics := semantic.Check(statements, slices.Collect(maps.Keys(i.Variables))...); len(diagnostics) > 0 {
+			return parser.ErrorList(diagnostics)
+		}
+	}
+
+	if i.Width > 0 {
+		i.state.Width = i.Width
+	}
+	if i.Height > 0 {
+		i.state.Height = i.Height
+	}
+	if err := i.checkPixels(i.state.Width, i.state.Height); err != nil {
+		return err
+	}
+	for name, value := range i.Variables {
+		i.state.Define(name, value)
+	}
+
+	ctx, cancel := i.Limits.withTimeLimit(ctx)
+	defer cancel()
+	i.ctx = ctx
 	for _, stmt := range statements {
-		i.executeStatement(stmt)
+		if err := i.executeStatement(stmt); err != nil {
+			return err
+		}
+	}
+	if i.state.Drawn() && len(i.state.DisplayList().Ops) > i.written && i.Output != "" {
+		format := i.Format
+		if format == "" {
+			var err error
+			if format, err = render.FormatOf(i.Output); err != nil {
+				return err
+			}
+		}
+		return i.Sink.Save(i.Output, format, i.state.DisplayList())
+	}
+	return nil
+}
+
+// logf 输出执行过程的信息；试探执行 STEP ADAPTIVE 的循环体时不输出，以免信息重复
+func (i *Interpreter) logf(format string, args ...interface{}) {
+	if i.Log != nil && !i.state.Probing() {
+		fmt.Fprintf(i.Log, format, args...)
 	}
 }
 
 // 执行语句
-func (i *Interpreter) executeStatement(stmt parser.Statement) {
+func (i *Interpreter) executeStatement(stmt parser.Statement) error {
+	var err error
 	switch stmt := stmt.(type) {
 	case *parser.OriginStatement:
-		i.executeOriginStatement(stmt)
+		err = i.executeOriginStatement(stmt)
 	case *parser.ScaleStatement:
-		i.executeScaleStatement(stmt)
+		err = i.executeScaleStatement(stmt)
 	case *parser.RotStatement:
-		i.executeRotStatement(stmt)
+		err = i.executeRotStatement(stmt)
+	case *parser.ShearStatement:
+		err = i.executeShearStatement(stmt)
+	case *parser.ReflectStatement:
+		err = i.executeReflectStatement(stmt)
+	case *parser.TransformStatement:
+		err = i.executeTransformStatement(stmt)
+	case *parser.TransformModeStatement:
+		i.executeTransformModeStatement(stmt)
+	case *parser.PushStatement:
+		i.state.Push()
+	case *parser.PopStatement:
+		if !i.state.Pop() {
+			err = errorf(stmt.Pos(), "POP without matching PUSH")
+		}
+	case *parser.DrawModeStatement:
+		i.executeDrawModeStatement(stmt)
+	case *parser.WidthStatement:
+		err = i.executeWidthStatement(stmt)
+	case *parser.JoinStatement:
+		i.state.Pen.Join = render.Join(strings.ToLower(stmt.Join))
+		i.logf("Line join set to: %s\n", i.state.Pen.Join)
+	case *parser.CapStatement:
+		i.state.Pen.Cap = render.Cap(strings.ToLower(stmt.Cap))
+		i.logf("Line cap set to: %s\n", i.state.Pen.Cap)
+	case *parser.OutputStatement:
+		err = i.executeOutputStatement(stmt)
 	case *parser.AssignmentStatement:
-		i.executeAssignmentStatement(stmt)
+		err = i.executeAssignmentStatement(stmt)
+	case *parser.ExpressionStatement:
+		err = i.executeExpressionStatement(stmt)
+	case *parser.FunctionDeclaration:
+		err = i.executeFunctionDeclaration(stmt)
 	case *parser.ForStatement:
-		i.executeForStatement(stmt)
+		err = i.executeForStatement(stmt)
+	case *parser.BlockStatement:
+		err = i.executeBlockStatement(stmt)
+	case *parser.IfStatement:
+		err = i.executeIfStatement(stmt)
+	case *parser.DrawStatement:
+		err = i.executeDrawStatement(stmt)
 	case *parser.CommentStatement:
 		i.executeCommentStatement(stmt)
+	default:
+		err = errorf(stmt.Pos(), "Unknown statement type %T", stmt)
 	}
+	// 记录出错的最内层语句，外层的 FOR / IF / 语句块原样向上传递
+	if e, ok := err.(*RuntimeError); ok && e.Stmt == nil {
+		e.Stmt = stmt
+		if !e.Pos.IsValid() {
+			e.Pos = stmt.Pos()
+		}
+	}
+	return err
 }
 
 // 执行 ORIGIN 语句
-func (i *Interpreter) executeOriginStatement(stmt *parser.OriginStatement) {
+func (i *Interpreter) executeOriginStatement(stmt *parser.OriginStatement) error {
 	// 计算表达式的值
-	x := i.evaluateExpression(stmt.X)
-	y := i.evaluateExpression(stmt.Y)
+	x, y, err := i.evaluatePair(stmt.X, stmt.Y)
+	if err != nil {
+		return err
+	}
 	// 更新坐标系的原点
-	i.state.ApplyOrigin(x[0], y[0])
-	fmt.Printf("Origin set to: (%f, %f)\n", x[0], y[0])
+	i.state.ApplyOrigin(x, y)
+	i.logf("Origin set to: (%f, %f)\n", x, y)
+	return nil
 }
 
 // 执行 SCALE 语句
-func (i *Interpreter) executeScaleStatement(stmt *parser.ScaleStatement) {
+func (i *Interpreter) executeScaleStatement(stmt *parser.ScaleStatement) error {
 	// 计算表达式的值
-	x := i.evaluateExpression(stmt.X)
-	y := i.evaluateExpression(stmt.Y)
+	x, y, err := i.evaluatePair(stmt.X, stmt.Y)
+	if err != nil {
+		return err
+	}
 	// 更新比例因子
-	i.state.ApplyScale(x[0], y[0])
-	fmt.Printf("Scale set to: (%f, %f)\n", x[0], y[0])
+	i.state.ApplyScale(x, y)
+	i.logf("Scale set to: (%f, %f)\n", x, y)
+	return nil
 }
 
 // 执行 ROT 语句
-func (i *Interpreter) executeRotStatement(stmt *parser.RotStatement) {
+func (i *Interpreter) executeRotStatement(stmt *parser.RotStatement) error {
 	// 计算角度的值
-	angle := i.evaluateExpression(stmt.Angle)
-	angle1 := angle[0] * 180 / math.Pi
+	angle, err := i.evaluateExpression(stmt.Angle)
+	if err != nil {
+		return err
+	}
+	angle1 := angle * 180 / math.Pi
 	// 更新旋转角度
-	i.state.ApplyRotation(angle[0])
-	fmt.Printf("Rotation set to: %f radians\n", angle1)
+	i.state.ApplyRotation(angle)
+	i.logf("Rotation set to: %f radians\n", angle1)
+	return nil
+}
+
+// 执行 SHEAR 语句
+func (i *Interpreter) executeShearStatement(stmt *parser.ShearStatement) error {
+	kx, ky, err := i.evaluatePair(stmt.X, stmt.Y)
+	if err != nil {
+		return err
+	}
+	i.state.ApplyShear(kx, ky)
+	i.logf("Shear set to: (%f, %f)\n", kx, ky)
+	return nil
+}
+
+// 执行 REFLECT 语句
+func (i *Interpreter) executeReflectStatement(stmt *parser.ReflectStatement) error {
+	angle, err := i.evaluateExpression(stmt.Angle)
+	if err != nil {
+		return err
+	}
+	i.state.ApplyReflection(angle)
+	i.logf("Reflection axis set to: %f radians\n", angle)
+	return nil
+}
+
+// 执行 TRANSFORM IS (a, b, c, d, e, f) 语句
+func (i *Interpreter) executeTransformStatement(stmt *parser.TransformStatement) error {
+	if len(stmt.Components) != 6 {
+		return errorf(stmt.Pos(), "TRANSFORM expects 6 components (a, b, c, d, e, f), got %d", len(stmt.Components))
+	}
+	var v [6]float64
+	for k, component := range stmt.Components {
+		val, err := i.evaluateExpression(component)
+		if err != nil {
+			return err
+		}
+		v[k] = val
+	}
+	m := semantic.Matrix{A: v[0], B: v[1], C: v[2], D: v[3], E: v[4], F: v[5]}
+	i.state.ApplyTransform(m)
+	i.logf("Transform set to: %v\n", v)
+	return nil
+}
+
+// 执行 TRANSFORM IS CUMULATIVE / ABSOLUTE 语句
+func (i *Interpreter) executeTransformModeStatement(stmt *parser.TransformModeStatement) {
+	i.state.SetCumulative(stmt.Cumulative)
+	i.logf("Cumulative transforms: %v\n", stmt.Cumulative)
+}
+
+// 执行 DRAW IS LINES / POINTS 语句
+func (i *Interpreter) executeDrawModeStatement(stmt *parser.DrawModeStatement) {
+	i.state.Pen.Lines = stmt.Lines
+	i.logf("Draw lines: %v\n", stmt.Lines)
+}
+
+// 执行 WIDTH 语句，设置折线的线宽
+func (i *Interpreter) executeWidthStatement(stmt *parser.WidthStatement) error {
+	width, err := i.evaluateExpression(stmt.Width)
+	if err != nil {
+		return err
+	}
+	if !(width > 0) || math.IsInf(width, 0) {
+		return errorf(stmt.Width.Pos(), "WIDTH must be a positive number, got %v", width)
+	}
+	i.state.Pen.Width = width
+	i.logf("Line width set to: %f\n", width)
+	return nil
+}
+
+// 执行 OUTPUT 语句，把画布当前的内容写入文件
+func (i *Interpreter) executeOutputStatement(stmt *parser.OutputStatement) error {
+	format, err := render.FormatOf(stmt.Path)
+	if err != nil {
+		return errorf(stmt.Pos(), "%v", err)
+	}
+	if i.state.Probing() {
+		return nil
+	}
+	if err := i.Sink.Save(stmt.Path, format, i.state.DisplayList()); err != nil {
+		return errorf(stmt.Pos(), "%v", err)
+	}
+	i.written = len(i.state.DisplayList().Ops)
+	i.logf("Image written to: %s\n", stmt.Path)
+	return nil
 }
 
 // 执行赋值语句
-func (i *Interpreter) executeAssignmentStatement(stmt *parser.AssignmentStatement) {
+func (i *Interpreter) executeAssignmentStatement(stmt *parser.AssignmentStatement) error {
 	// 计算右侧表达式的值
-	value := i.evaluateExpression(stmt.Value)
-	// 输出结果
-	fmt.Printf("Assignment: %s = %v\n", stmt.Identifier, value)
+	value, err := i.evaluateExpression(stmt.Value)
+	if err != nil {
+		return err
+	}
+	// 写入变量表，之后的表达式按名字查找
+	i.state.Assign(stmt.Identifier, value)
+	i.logf("Assignment: %s = %v\n", stmt.Identifier, value)
+	return nil
+}
+
+// 执行函数声明，把函数登记到函数表中
+func (i *Interpreter) executeFunctionDeclaration(stmt *parser.FunctionDeclaration) error {
+	if prev, ok := i.functions[stmt.Name]; ok {
+		return errorf(stmt.Pos(), "Function %s already declared at %s", stmt.Name, prev.Pos())
+	}
+	i.functions[stmt.Name] = stmt
+	i.logf("Function declared: %s(%s)\n", stmt.Name, strings.Join(stmt.Params, ", "))
+	return nil
+}
+
+// 执行表达式语句
+func (i *Interpreter) executeExpressionStatement(stmt *parser.ExpressionStatement) error {
+	value, err := i.evaluateExpression(stmt.X)
+	if err != nil {
+		return err
+	}
+	i.logf("%s: %v\n", stmt.Pos(), value)
+	return nil
 }
 
 // 执行 FOR 语句
-func (i *Interpreter) executeForStatement(stmt *parser.ForStatement) {
+func (i *Interpreter) executeForStatement(stmt *parser.ForStatement) error {
 	// 计算 FOR 语句中的起始值、终止值和步长
-	start := i.evaluateExpression(stmt.Start)[0]
-	end := i.evaluateExpression(stmt.End)[0]
-	step := i.evaluateExpression(stmt.Step)[0]
-	var drawExpr parser.Expression
-	// 计算绘制表达式
-	if assignStmt, ok := stmt.Body.(*parser.AssignmentStatement); ok {
-		drawExpr = assignStmt.Value
+	start, end, err := i.evaluatePair(stmt.Start, stmt.End)
+	if err != nil {
+		return err
+	}
+	var step float64
+	tolerance := semantic.DefaultTolerance
+	switch {
+	case !stmt.Adaptive:
+		if step, err = i.evaluateExpression(stmt.Step); err != nil {
+			return err
+		}
+	case stmt.Tolerance != nil:
+		if tolerance, err = i.evaluateExpression(stmt.Tolerance); err != nil {
+			return err
+		}
+		if !(tolerance > 0) || math.IsInf(tolerance, 0) {
+			return errorf(stmt.Tolerance.Pos(), "TOLERANCE must be a positive number, got %v", tolerance)
+		}
+	}
+
+	// 循环变量不能遮蔽已有的变量
+	if _, ok := i.state.Lookup(stmt.LoopVar); ok {
+		return errorf(stmt.Pos(), "Loop variable %s shadows an existing variable", stmt.LoopVar)
+	}
+
+	// 执行循环，循环体在循环变量所在的作用域内执行
+	body := func() error {
+		if err := i.countIteration(); err != nil {
+			return err
+		}
+		return i.executeStatement(stmt.Body)
+	}
+	if stmt.Adaptive {
+		// 自适应采样需要有限的参数区间
+		if math.IsNaN(start) || math.IsNaN(end) || math.IsInf(start, 0) || math.IsInf(end, 0) {
+			return errorf(stmt.Pos(), "FOR %s with STEP ADAPTIVE needs a finite range, got %v to %v", stmt.LoopVar, start, end)
+		}
+		err = i.state.ParseAdaptiveForStatement(stmt.LoopVar, start, end, tolerance, body)
 	} else {
-		panic("Expected AssignmentStatement in FOR loop body")
+		if _, err := semantic.LoopCount(stmt.LoopVar, start, end, step); err != nil {
+			return errorf(stmt.Step.Pos(), "%v", err)
+		}
+		err = i.state.ParseForStatement(stmt.LoopVar, start, end, step, body)
+	}
+	i.loopVars[stmt.LoopVar] = stmt.Pos()
+	return err
+}
+
+// 执行语句块
+func (i *Interpreter) executeBlockStatement(stmt *parser.BlockStatement) error {
+	for _, s := range stmt.Statements {
+		if err := i.executeStatement(s); err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+// 执行 IF 语句，条件非零时执行 THEN 分支，否则执行 ELSE 分支（如果有）
+func (i *Interpreter) executeIfStatement(stmt *parser.IfStatement) error {
+	condition, err := i.evaluateExpression(stmt.Condition)
+	if err != nil {
+		return err
+	}
+	if condition != 0 {
+		return i.executeStatement(stmt.Then)
+	} else if stmt.Else != nil {
+		return i.executeStatement(stmt.Else)
+	}
+	return nil
+}
 
-	// 执行循环
-	i.state.ParseForStatement(start, end, step, drawExpr)
+// 执行 DRAW 语句，按当前坐标变换和画笔画一个采样点
+func (i *Interpreter) executeDrawStatement(stmt *parser.DrawStatement) error {
+	if len(stmt.Components) != 2 {
+		return errorf(stmt.Pos(), "DRAW expects 2 components (x, y), got %d", len(stmt.Components))
+	}
+	if err := i.countSample(); err != nil {
+		return err
+	}
+	x, y, err := i.evaluatePair(stmt.Components[0], stmt.Components[1])
+	if err != nil {
+		return err
+	}
+	if p, ok := i.state.DrawPoint(stmt, x, y); ok {
+		i.logf("Drawing point: %v %v\n", p.X, p.Y)
+	}
+	return nil
 }
 
 func (i *Interpreter) executeCommentStatement(stmt *parser.CommentStatement) {
 }
 
+// evaluatePair 依次计算两个表达式的值
+func (i *Interpreter) evaluatePair(a, b parser.Expression) (float64, float64, error) {
+	x, err := i.evaluateExpression(a)
+	if err != nil {
+		return 0, 0, err
+	}
+	y, err := i.evaluateExpression(b)
+	if err != nil {
+		return 0, 0, err
+	}
+	return x, y, nil
+}
+
 // 计算表达式的值
-func (i *Interpreter) evaluateExpression(expr parser.Expression) []float64 {
+func (i *Interpreter) evaluateExpression(expr parser.Expression) (float64, error) {
 	switch expr := expr.(type) {
 	case *parser.ConstantExpression:
 		// 常量表达式
-		if expr.Value == "PI" {
-			return []float64{math.Pi}
-		} else if expr.Value == "E" {
-			return []float64{math.E}
-		}
-		val, err := strconv.ParseFloat(expr.Value, 64)
+		val, err := semantic.ConstantValue(expr.Value)
 		if err != nil {
-			panic(fmt.Sprintf("Failed to parse float: %v", err))
+			return 0, errorf(expr.Pos(), "%v", err)
 		}
-		return []float64{val}
+		return val, nil
 	case *parser.BinaryExpression:
 		// 二元表达式
-		left := i.evaluateExpression(expr.Left)[0]
-		right := i.evaluateExpression(expr.Right)[0]
-		var result float64
+		left, err := i.evaluateExpression(expr.Left)
+		if err != nil {
+			return 0, err
+		}
+		// AND / OR 短路求值，非零即为真
+		switch expr.Operator {
+		case token.AND:
+			if left == 0 {
+				return 0, nil
+			}
+			right, err := i.evaluateExpression(expr.Right)
+			return truth(right != 0), err
+		case token.OR:
+			if left != 0 {
+				return 1, nil
+			}
+			right, err := i.evaluateExpression(expr.Right)
+			return truth(right != 0), err
+		}
+		right, err := i.evaluateExpression(expr.Right)
+		if err != nil {
+			return 0, err
+		}
 		switch expr.Operator {
 		case token.PLUS:
-			result = left + right
+			return left + right, nil
 		case token.MINUS:
-			result = left - right
+			return left - right, nil
 		case token.MUL:
-			result = left * right
+			return left * right, nil
 		case token.DIV:
-			result = left / right
+			return left / right, nil
+		case token.POWER:
+			return math.Pow(left, right), nil
+		case token.LT:
+			return truth(left < right), nil
+		case token.LE:
+			return truth(left <= right), nil
+		case token.GT:
+			return truth(left > right), nil
+		case token.GE:
+			return truth(left >= right), nil
+		case token.EQ:
+			return truth(left == right), nil
+		case token.NE:
+			return truth(left != right), nil
+		}
+		return 0, errorf(expr.Pos(), "Unknown binary operator %s", expr.Operator)
+	case *parser.UnaryExpression:
+		// 一元表达式
+		operand, err := i.evaluateExpression(expr.Operand)
+		if err != nil {
+			return 0, err
+		}
+		switch expr.Operator {
+		case token.NOT:
+			return truth(operand == 0), nil
+		case token.MINUS:
+			return -operand, nil
 		}
-		return []float64{result}
+		return operand, nil
 	case *parser.FunctionCallExpression:
 		// 函数调用表达式
-		var args []float64
-		for _, arg := range expr.Arguments {
-			args = append(args, i.evaluateExpression(arg)[0])
+		args := make([]float64, len(expr.Arguments))
+		for k, arg := range expr.Arguments {
+			val, err := i.evaluateExpression(arg)
+			if err != nil {
+				return 0, err
+			}
+			args[k] = val
 		}
-		// 调用函数
-		return i.state.ApplyFunction(expr.Name, args)
+		// 用户自定义函数优先于内置函数
+		if fn, ok := i.functions[expr.Name]; ok {
+			return i.callFunction(expr, fn, args)
+		}
+		// 调用内置函数
+		fn, ok := builtin.Lookup(expr.Name)
+		if !ok {
+			return 0, errorf(expr.Pos(), "Unknown function: %s", expr.Name)
+		}
+		result, err := fn.Call(args)
+		if err != nil {
+			return 0, errorf(expr.Pos(), "%v", err)
+		}
+		return result, nil
 	case *parser.VariableExpression:
-		if val, ok := i.state.Variables[expr.Name]; ok {
-			return []float64{val}
+		if val, ok := i.state.Lookup(expr.Name); ok {
+			return val, nil
 		}
-		panic(fmt.Sprintf("Undefined variable: %v", expr.Name))
+		if pos, ok := i.loopVars[expr.Name]; ok {
+			return 0, errorf(expr.Pos(), "Loop variable %s is only visible inside the FOR statement at %s", expr.Name, pos)
+		}
+		return 0, errorf(expr.Pos(), "Undefined variable: %v", expr.Name)
 	default:
 		// 错误处理
-		panic("Unknown expression type")
+		return 0, errorf(expr.Pos(), "Unknown expression type %T", expr)
+	}
+}
+
+// 调用用户自定义函数：参数绑定在独立的调用帧中，函数体看不到调用者的局部变量
+func (i *Interpreter) callFunction(call *parser.FunctionCallExpression, fn *parser.FunctionDeclaration, args []float64) (float64, error) {
+	if len(args) != len(fn.Params) {
+		return 0, errorf(call.Pos(), "Function %s expects %d argument(s), got %d", fn.Name, len(fn.Params), len(args))
+	}
+	if max := i.Limits.callDepthLimit(); i.callDepth >= max {
+		return 0, &RuntimeError{Pos: call.Pos(), Msg: fmt.Sprintf("Maximum call depth %d exceeded in %s", max, fn.Name), Err: ErrLimit}
+	}
+	if err := i.checkContext(); err != nil {
+		return 0, err
+	}
+
+	bindings := make(map[string]float64, len(args))
+	for k, param := range fn.Params {
+		bindings[param] = args[k]
+	}
+
+	var result float64
+	i.callDepth++
+	defer func() { i.callDepth-- }()
+	err := i.state.WithFrame(bindings, func() (err error) {
+		result, err = i.evaluateExpression(fn.Body)
+		return err
+	})
+	return result, err
+}
+
+// truth 把布尔值转换为 1 或 0
+func truth(b bool) float64 {
+	if b {
+		return 1
 	}
+	return 0
 }
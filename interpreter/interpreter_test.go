@@ -0,0 +1,571 @@
+package interpreter
+
+import (
+	"compilers/lexer"
+	"compilers/parser"
+	"compilers/render"
+	"compilers/semantic"
+	"context"
+	"errors"
+	"fmt"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// evaluate 在 T = 3 的环境中执行 input，返回其中赋给 x 的值
+func evaluate(t *testing.T, input string) float64 {
+	t.Helper()
+	i := NewInterpreter(parser.New(lexer.New("T = 3;\n" + input)))
+	if err := i.Interpret(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	x, ok := i.state.Lookup("x")
+	if !ok {
+		t.Fatalf("x is not assigned")
+	}
+	return x
+}
+
+func TestEvaluatePower(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"x = -2**2;", -4},
+		{"x = (-2)**2;", 4},
+		{"x = 2**3**2;", 512},
+		{"x = 2**-1;", 0.5},
+		{"x = 2*3**2;", 18},
+		{"x = 1+T**2;", 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := evaluate(t, tt.input)
+			if got != tt.expected {
+				t.Errorf("expected %v, but got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestEvaluateCondition(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"x = (1 < 2);", 1},
+		{"x = (2 <= 1);", 0},
+		{"x = (T == 3) + (T != 3);", 1},
+		{"x = (T > 2 AND T >= 4);", 0},
+		{"x = (T < 0 OR NOT T == 0);", 1},
+		{"x = (NOT (1 < 2) OR 0);", 0},
+		// 短路求值：右侧无穷递归的函数调用不会被求值
+		{"FUNC loop(a) = loop(a); x = (0 AND loop(1));", 0},
+		{"FUNC loop(a) = loop(a); x = (1 OR loop(1));", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := evaluate(t, tt.input)
+			if got != tt.expected {
+				t.Errorf("expected %v, but got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestEvaluateFunctionCall(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"x = SQRT(T**2 + 16);", 5},
+		{"x = MAX(1, T, 2);", 3},
+		{"FUNC sq(a) = a*a; x = sq(T) - sq(2);", 5},
+		{"FUNC f(a, b) = a - b; x = f(T, 1);", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := evaluate(t, tt.input)
+			if got != tt.expected {
+				t.Errorf("expected %v, but got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRuntimeError(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+		stmt  string // 出错的语句
+	}{
+		{
+			// 语义检查认为 y 可能在 IF 中被赋值，执行时才发现未定义
+			input: "IF 0 THEN y = 1;\nx = 1 + y;\nz = 1;",
+			err:   "2:9: Undefined variable: y",
+			stmt:  "x = 1 + y",
+		},
+		{
+			input: "FUNC f(a) = f(a) + 1;\nx = f(1);\nz = 1;",
+			err:   "1:13: Maximum call depth 64 exceeded in f",
+			stmt:  "x = f(1)",
+		},
+		{
+			input: "s = 0;\nFOR T FROM 0 TO 1 STEP s DRAW (T, T);\nz = 1;",
+			err:   "2:24: STEP of FOR T is zero, the loop would never end",
+			stmt:  "FOR T FROM 0 TO 1 STEP s DRAW (T, T)",
+		},
+		{
+			input: "a = 1;\nFOR T FROM a TO 0 STEP 0.5 DRAW (T, T);\nz = 1;",
+			err:   "2:24: STEP 0.5 of FOR T never reaches 0 from 1",
+			stmt:  "FOR T FROM a TO 0 STEP 0.5 DRAW (T, T)",
+		},
+		{
+			input: "a = 0;\nFOR T FROM 0 TO 1/a STEP 1 DRAW (T, T);\nz = 1;",
+			err:   "2:26: FOR T FROM 0 TO +Inf STEP 1 needs finite numbers",
+			stmt:  "FOR T FROM 0 TO 1 / a STEP 1 DRAW (T, T)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			i := NewInterpreter(parser.New(lexer.New(tt.input)))
+			err := i.Interpret(context.Background())
+			var runtimeErr *RuntimeError
+			if !errors.As(err, &runtimeErr) {
+				t.Fatalf("expected a *RuntimeError, but got %#v", err)
+			}
+			if got := err.Error(); got != tt.err {
+				t.Errorf("expected error %q, but got %q", tt.err, got)
+			}
+			if got := parser.Format(runtimeErr.Stmt); got != tt.stmt {
+				t.Errorf("expected failing statement %q, but got %q", tt.stmt, got)
+			}
+			// 出错之后的语句不再执行
+			if _, ok := i.state.Lookup("z"); ok {
+				t.Errorf("statements after the error were executed")
+			}
+		})
+	}
+}
+
+func TestInterpretDiagnostics(t *testing.T) {
+	i := NewInterpreter(parser.New(lexer.New("x = ;\ny = z;")))
+	err := i.Interpret(context.Background())
+	var list parser.ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("expected a parser.ErrorList, but got %#v", err)
+	}
+	if expected := "1:5: Unexpected token in atom: ;"; err.Error() != expected {
+		t.Errorf("expected error %q, but got %q", expected, err.Error())
+	}
+}
+
+// 所有 FOR 循环画在同一张画布上，OUTPUT 语句写出当时的画布
+func TestCanvas(t *testing.T) {
+	dir := t.TempDir()
+	snapshot := filepath.Join(dir, "first.png")
+	input := "FOR T FROM 100 TO 100 STEP 1 DRAW (T, T);\n" +
+		"OUTPUT IS " + strconv.Quote(snapshot) + ";\n" +
+		"FOR T FROM 200 TO 200 STEP 1 DRAW (T, T);\n" +
+		"FOR T FROM 300 TO 300 STEP 1 DRAW (T, T);"
+
+	// OUTPUT 语句写出当时的画布，之后画的内容在程序结束时写入默认的输出文件
+	i := NewInterpreter(parser.New(lexer.New(input)))
+	i.Output = filepath.Join(dir, "final.png")
+	if err := i.Interpret(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expectPoints(t, snapshot, map[int]bool{100: true, 200: false, 300: false})
+	expectPoints(t, i.Output, map[int]bool{100: true, 200: true, 300: true})
+
+	// 最后一次 OUTPUT 之后没有再画时不写默认的输出文件
+	i = NewInterpreter(parser.New(lexer.New(input + "\nOUTPUT IS " + strconv.Quote(filepath.Join(dir, "last.png")) + ";")))
+	i.Output = filepath.Join(dir, "unused.png")
+	if err := i.Interpret(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := os.Stat(i.Output); !os.IsNotExist(err) {
+		t.Errorf("expected no image at %s, but got %v", i.Output, err)
+	}
+	expectPoints(t, filepath.Join(dir, "last.png"), map[int]bool{100: true, 200: true, 300: true})
+
+	// 没有 OUTPUT 语句时在程序结束后写出全部曲线
+	i = NewInterpreter(parser.New(lexer.New(strings.Replace(input, "OUTPUT", "// OUTPUT", 1))))
+	i.Output = filepath.Join(dir, "all.png")
+	if err := i.Interpret(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expectPoints(t, i.Output, map[int]bool{100: true, 200: true, 300: true})
+}
+
+// expectPoints 检查图像中的点 (k, k) 是否被画过
+func expectPoints(t *testing.T, path string, points map[int]bool) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, drawn := range points {
+		r, _, _, _ := img.At(k, k).RGBA()
+		if got := r < 0x8000; got != drawn {
+			t.Errorf("%s: expected point (%d, %d) drawn = %v, but got %v", path, k, k, drawn, got)
+		}
+	}
+}
+
+// DRAW 语句在显示列表中记录用户坐标和设备坐标
+func TestDisplayList(t *testing.T) {
+	input := "ORIGIN IS (100, 50);\nSCALE IS (10, 10);\nFOR T FROM 1 TO 2 STEP 1 DRAW (T, -T);\nOUTPUT IS " +
+		strconv.Quote(filepath.Join(t.TempDir(), "list.jsonl")) + ";"
+	i := NewInterpreter(parser.New(lexer.New(input)))
+	if err := i.Interpret(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := []render.Op{
+		&render.PointOp{World: render.Point{X: 1, Y: -1}, Device: render.Point{X: 110, Y: 40}, Radius: 2},
+		&render.PointOp{World: render.Point{X: 2, Y: -2}, Device: render.Point{X: 120, Y: 30}, Radius: 2},
+	}
+	if got := i.state.DisplayList().Ops; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, but got %v", expected, got)
+	}
+}
+
+// LINES 方式下相邻的采样点连成折线，在 NaN 和跳变处断开
+func TestDrawLines(t *testing.T) {
+	polyline := func(points ...render.Point) *render.PolylineOp {
+		return &render.PolylineOp{World: points, Device: points}
+	}
+	// sawtooth 返回 T 从 from 到 to、步长 0.125 时 (T, MOD(T, 1)) 放大 100 倍画出的折线
+	sawtooth := func(from, to float64) *render.PolylineOp {
+		op := &render.PolylineOp{}
+		for t := from; t <= to; t += 0.125 {
+			op.World = append(op.World, render.Point{X: t, Y: math.Mod(t, 1)})
+			op.Device = append(op.Device, render.Point{X: 100 * t, Y: 100 * math.Mod(t, 1)})
+		}
+		return op
+	}
+	tests := []struct {
+		input    string
+		expected []render.Op
+	}{
+		{
+			input:    "DRAW IS LINES;\nFOR T FROM 0 TO 2 STEP 1 DRAW (T, T*T);",
+			expected: []render.Op{polyline(render.Point{X: 0, Y: 0}, render.Point{X: 1, Y: 1}, render.Point{X: 2, Y: 4})},
+		},
+		{
+			// T = 0 时 SQRT(-1) 为 NaN，折线分为两段
+			input: "DRAW IS LINES;\nFOR T FROM -1 TO 1 STEP 1 DRAW (T, SQRT(T*T - 1));",
+			expected: []render.Op{
+				polyline(render.Point{X: -1, Y: 0}),
+				polyline(render.Point{X: 1, Y: 0}),
+			},
+		},
+		{
+			// T = 1 的点经过坐标变换后溢出为无穷，同样跳过并断开折线
+			input: "x = 10**308;\nDRAW IS LINES;\nSCALE IS (10, 10);\nFOR T FROM 0 TO 2 STEP 1 DRAW (T, x * (T == 1));",
+			expected: []render.Op{
+				&render.PolylineOp{World: []render.Point{{X: 0, Y: 0}}, Device: []render.Point{{X: 0, Y: 0}}},
+				&render.PolylineOp{World: []render.Point{{X: 2, Y: 0}}, Device: []render.Point{{X: 20, Y: 0}}},
+			},
+		},
+		{
+			// 相邻两点相距 1000 像素，超过 jumpLimit
+			input: "DRAW IS LINES;\nFOR T FROM 0 TO 1 STEP 1 DRAW (T, 1000*T);",
+			expected: []render.Op{
+				polyline(render.Point{X: 0, Y: 0}),
+				polyline(render.Point{X: 1, Y: 1000}),
+			},
+		},
+		{
+			// 锯齿在每次回落处断开，最后一点单独成为一段
+			input:    "DRAW IS LINES;\nSCALE IS (100, 100);\nFOR T FROM 0 TO 2 STEP 0.125 DRAW (T, MOD(T, 1));",
+			expected: []render.Op{sawtooth(0, 0.875), sawtooth(1, 1.875), sawtooth(2, 2)},
+		},
+		{
+			// 尖峰的两条边都很长，不是跳变
+			input: "DRAW IS LINES;\nSCALE IS (10, 10);\nFOR T FROM 0 TO 4 STEP 1 DRAW (T, 0 + (T == 2) * 10);",
+			expected: []render.Op{&render.PolylineOp{
+				World:  []render.Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 2, Y: 10}, {X: 3, Y: 0}, {X: 4, Y: 0}},
+				Device: []render.Point{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 20, Y: 100}, {X: 30, Y: 0}, {X: 40, Y: 0}},
+			}},
+		},
+		{
+			// JOIN IS ROUND 和 CAP IS ROUND 恢复默认的样式
+			input:    "DRAW IS LINES;\nJOIN IS MITER;\nCAP IS BUTT;\nJOIN IS ROUND;\nCAP IS ROUND;\nFOR T FROM 0 TO 1 STEP 1 DRAW (T, 0);",
+			expected: []render.Op{polyline(render.Point{X: 0, Y: 0}, render.Point{X: 1, Y: 0})},
+		},
+		{
+			// POP 恢复 PUSH 时的画笔
+			input: "DRAW IS LINES;\nWIDTH IS 3;\nPUSH;\nDRAW IS POINTS;\nJOIN IS MITER;\nPOP;\nFOR T FROM 0 TO 1 STEP 1 DRAW (T, 0);",
+			expected: []render.Op{
+				&render.StyleOp{Style: render.Style{Width: 3, Join: render.JoinRound, Cap: render.CapRound}},
+				polyline(render.Point{X: 0, Y: 0}, render.Point{X: 1, Y: 0}),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			i := NewInterpreter(parser.New(lexer.New(tt.input)))
+			i.Output = filepath.Join(t.TempDir(), "out.png")
+			if err := i.Interpret(context.Background()); err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got := i.state.DisplayList().Ops; !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, but got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// STEP ADAPTIVE 在直线上只用初始的等分点，在弯曲处加密，试探执行不改变变量
+func TestAdaptiveFor(t *testing.T) {
+	run := func(t *testing.T, input string) *Interpreter {
+		t.Helper()
+		i := NewInterpreter(parser.New(lexer.New(input)))
+		i.Output = filepath.Join(t.TempDir(), "out.png")
+		if err := i.Interpret(context.Background()); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		return i
+	}
+	polylines := func(i *Interpreter) [][]render.Point {
+		var lines [][]render.Point
+		for _, op := range i.state.DisplayList().Ops {
+			if op, ok := op.(*render.PolylineOp); ok {
+				lines = append(lines, op.Device)
+			}
+		}
+		return lines
+	}
+
+	t.Run("straight line", func(t *testing.T) {
+		i := run(t, "n = 0;\nDRAW IS LINES;\nFOR T FROM 0 TO 1 STEP ADAPTIVE BEGIN n = n + 1; DRAW (100*T, 50*T); END;")
+		lines := polylines(i)
+		// 32 个等分区间的端点和中点，都不需要再对分
+		if len(lines) != 1 || len(lines[0]) != 65 {
+			t.Fatalf("expected one polyline of 65 points, but got %v", lines)
+		}
+		if first, last := lines[0][0], lines[0][64]; first != (render.Point{}) || last != (render.Point{X: 100, Y: 50}) {
+			t.Errorf("expected the polyline to run from (0, 0) to (100, 50), but got %v to %v", first, last)
+		}
+		if n, _ := i.state.Lookup("n"); n != 65 {
+			t.Errorf("expected the body to run 65 times, but n = %v", n)
+		}
+	})
+
+	t.Run("tolerance", func(t *testing.T) {
+		counts := make([]int, 2)
+		for k, tolerance := range []string{"1", "0.01"} {
+			i := run(t, "DRAW IS LINES;\nFOR T FROM -1 TO 1 STEP ADAPTIVE TOLERANCE "+tolerance+" DRAW (400*T, 400*T*T);")
+			lines := polylines(i)
+			if len(lines) != 1 {
+				t.Fatalf("expected one polyline, but got %d", len(lines))
+			}
+			// 折线每一段中点偏离抛物线的距离不超过容差
+			limit, _ := strconv.ParseFloat(tolerance, 64)
+			for n := 0; n+1 < len(lines[0]); n++ {
+				a, b := lines[0][n], lines[0][n+1]
+				x := (a.X + b.X) / 2
+				if d := (a.Y+b.Y)/2 - x*x/400; d > limit {
+					t.Errorf("expected a deviation of at most %v, but got %v at x = %v", limit, d, x)
+				}
+			}
+			counts[k] = len(lines[0])
+		}
+		if counts[1] <= counts[0] {
+			t.Errorf("expected more samples for a smaller tolerance, but got %v", counts)
+		}
+	})
+
+	t.Run("asymptote", func(t *testing.T) {
+		i := run(t, "DRAW IS LINES;\nFOR T FROM 0 TO 3 STEP ADAPTIVE DRAW (T, TAN(T));")
+		lines := polylines(i)
+		if len(lines) < 2 {
+			t.Fatalf("expected the curve to break near PI/2, but got %d polyline(s)", len(lines))
+		}
+		if n := len(i.state.DisplayList().Ops); n > semantic.MaxAdaptiveSamples {
+			t.Errorf("expected at most %d samples, but got %d ops", semantic.MaxAdaptiveSamples, n)
+		}
+	})
+}
+
+// 超出 Limits 或者 context 被取消时执行停止，错误可以用 errors.Is 判断
+func TestLimits(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		input  string
+		limits Limits
+		ctx    context.Context
+		err    string
+		is     error
+	}{
+		{
+			input:  "FOR T FROM 0 TO 1000000 STEP 1 DRAW (T, T);",
+			limits: Limits{MaxIterations: 100},
+			err:    "1:1: Iteration limit of 100 exceeded",
+			is:     ErrLimit,
+		},
+		{
+			input:  "FOR T FROM 0 TO 1 STEP ADAPTIVE DRAW (T, T);",
+			limits: Limits{MaxIterations: 10},
+			err:    "1:1: Iteration limit of 10 exceeded",
+			is:     ErrLimit,
+		},
+		{
+			input:  "FOR T FROM 0 TO 100 STEP 1 DRAW (T, T);",
+			limits: Limits{MaxSamples: 10},
+			err:    "1:28: Sample limit of 10 exceeded",
+			is:     ErrLimit,
+		},
+		{
+			input:  "FUNC f(a) = f(a) + 1;\nx = f(1);",
+			limits: Limits{MaxCallDepth: 5},
+			err:    "1:13: Maximum call depth 5 exceeded in f",
+			is:     ErrLimit,
+		},
+		{
+			input:  "FOR T FROM 0 TO 1000000000 STEP 1 IF T < 0 THEN DRAW (T, T);",
+			limits: Limits{MaxTime: 10 * time.Millisecond},
+			err:    "1:1: Time limit of 10ms exceeded",
+			is:     ErrLimit,
+		},
+		{
+			input:  "FOR T FROM 0 TO 1 STEP 1 DRAW (T, T);",
+			limits: Limits{MaxPixels: 1000},
+			err:    "Image of 800x600 pixels exceeds the limit of 1000 pixels",
+			is:     ErrLimit,
+		},
+		{
+			input: "FUNC f(a) = a;\nFOR T FROM 0 TO 1 STEP 1 DRAW (T, f(T));",
+			ctx:   canceled,
+			err:   "2:1: Execution canceled: context canceled",
+			is:    context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			i := NewInterpreter(parser.New(lexer.New(tt.input)))
+			i.Output = filepath.Join(t.TempDir(), "out.png")
+			i.Limits = tt.limits
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			err := i.Interpret(ctx)
+			if err == nil || err.Error() != tt.err {
+				t.Fatalf("expected error %q, but got %v", tt.err, err)
+			}
+			if !errors.Is(err, tt.is) {
+				t.Errorf("expected errors.Is(err, %v)", tt.is)
+			}
+			if _, statErr := os.Stat(i.Output); statErr == nil {
+				t.Errorf("expected no image after the error")
+			}
+		})
+	}
+}
+
+// recordSink 记录保存的路径和当时的操作数
+type recordSink struct {
+	saved []string
+}
+
+func (s *recordSink) Save(path string, format render.Format, list *render.DisplayList) error {
+	s.saved = append(s.saved, fmt.Sprintf("%s %s %dx%d %d", path, format, list.Width, list.Height, len(list.Ops)))
+	return nil
+}
+
+// 图像经过 Sink 保存，执行信息写入 Log，注入的变量在执行之前定义
+func TestSinkAndLog(t *testing.T) {
+	// OUTPUT 语句保存当时的画布，之后又画了内容时在结束时保存到 Output
+	input := "FOR T FROM 0 TO 1 STEP 1 DRAW (T, a);\nOUTPUT IS \"a.svg\";\nFOR T FROM 0 TO 1 STEP 1 DRAW (T, a);"
+	var sink recordSink
+	var log strings.Builder
+	i := NewInterpreter(parser.New(lexer.New(input)))
+	i.Output = "b.png"
+	i.Sink = &sink
+	i.Log = &log
+	i.Width, i.Height = 40, 30
+	i.Variables = map[string]float64{"a": 5}
+	if err := i.Interpret(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if expected := []string{"a.svg svg 40x30 2", "b.png png 40x30 4"}; !reflect.DeepEqual(sink.saved, expected) {
+		t.Errorf("expected saves %q, but got %q", expected, sink.saved)
+	}
+	if !strings.Contains(log.String(), "Drawing point: 1 5\n") {
+		t.Errorf("expected the log to contain the drawn points, but got %q", log.String())
+	}
+
+	// 程序中没有 OUTPUT 语句时在结束时保存到 Output
+	sink = recordSink{}
+	i = NewInterpreter(parser.New(lexer.New("FOR T FROM 0 TO 1 STEP 1 DRAW (T, T);")))
+	i.Output = DefaultOutput
+	i.Sink = &sink
+	i.Log = nil
+	i.Format = render.JSONL
+	if err := i.Interpret(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if expected := []string{"output.png jsonl 800x600 2"}; !reflect.DeepEqual(sink.saved, expected) {
+		t.Errorf("expected saves %q, but got %q", expected, sink.saved)
+	}
+}
+
+// 不同的解释器实例可以同时执行，各自的变量和输出互不影响；NewInterpreter 不写默认的输出文件
+func TestConcurrentInterpreters(t *testing.T) {
+	dir := t.TempDir()
+	var wg sync.WaitGroup
+	for k := 1; k <= 4; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			input := fmt.Sprintf("x = %d;\nFOR T FROM 0 TO 1 STEP 1 DRAW (x * 100, x * 100);", k)
+			i := NewInterpreter(parser.New(lexer.New(input)))
+			i.Log = nil
+			i.Output = filepath.Join(dir, fmt.Sprintf("%d.png", k))
+			if err := i.Interpret(context.Background()); err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	for k := 1; k <= 4; k++ {
+		points := map[int]bool{}
+		for j := 1; j <= 4; j++ {
+			points[j*100] = j == k
+		}
+		expectPoints(t, filepath.Join(dir, fmt.Sprintf("%d.png", k)), points)
+	}
+
+	i := NewInterpreter(parser.New(lexer.New("FOR T FROM 0 TO 1 STEP 1 DRAW (T, T);")))
+	i.Sink = &recordSink{}
+	i.Log = nil
+	if err := i.Interpret(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if saved := i.Sink.(*recordSink).saved; len(saved) != 0 {
+		t.Errorf("expected no saved image without Output, but got %q", saved)
+	}
+}
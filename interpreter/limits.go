@@ -0,0 +1,86 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Limits 限制一次执行所用的资源，超过任何一项时执行立即停止，Interpret 返回一个 Err 为 ErrLimit 的 *RuntimeError。
+// 为零的字段表示不限制，MaxCallDepth 为零时使用默认的 64 层
+type Limits struct {
+	MaxSamples    int           // DRAW 计算的采样点总数，包括 STEP ADAPTIVE 试探执行时的采样点
+	MaxIterations int           // 所有 FOR 循环体执行的总次数，包括试探执行
+	MaxCallDepth  int           // 用户自定义函数调用的最大嵌套深度
+	MaxTime       time.Duration // 执行的最长时间，不包括解析和语义检查
+	MaxPixels     int           // 输出图像的最大像素数，即画布的宽乘以高
+}
+
+// ErrLimit 表示执行超出了 Limits 的限制，可以用 errors.Is 判断
+var ErrLimit = errors.New("Execution limit exceeded")
+
+// errTimeLimit 是超出 MaxTime 时 context 的 cause
+var errTimeLimit = errors.New("time limit")
+
+// maxCallDepth 是用户自定义函数调用默认的最大嵌套深度，用于阻止无穷递归
+const maxCallDepth = 64
+
+// limitf 创建一个超出限制的 RuntimeError
+func limitf(format string, args ...interface{}) error {
+	return &RuntimeError{Msg: fmt.Sprintf(format, args...), Err: ErrLimit}
+}
+
+// withTimeLimit 在 MaxTime 不为零时给 ctx 加上超时
+func (l Limits) withTimeLimit(ctx context.Context) (context.Context, context.CancelFunc) {
+	if l.MaxTime <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, l.MaxTime, errTimeLimit)
+}
+
+// callDepthLimit 返回用户自定义函数调用的最大嵌套深度
+func (l Limits) callDepthLimit() int {
+	if l.MaxCallDepth > 0 {
+		return l.MaxCallDepth
+	}
+	return maxCallDepth
+}
+
+// checkContext 在 context 被取消或超时后返回错误
+func (i *Interpreter) checkContext() error {
+	if i.ctx.Err() == nil {
+		return nil
+	}
+	cause := context.Cause(i.ctx)
+	if cause == errTimeLimit {
+		return limitf("Time limit of %v exceeded", i.Limits.MaxTime)
+	}
+	return &RuntimeError{Msg: fmt.Sprintf("Execution canceled: %v", cause), Err: cause}
+}
+
+// countIteration 记录 FOR 循环体的一次执行
+func (i *Interpreter) countIteration() error {
+	i.iterations++
+	if max := i.Limits.MaxIterations; max > 0 && i.iterations > max {
+		return limitf("Iteration limit of %d exceeded", max)
+	}
+	return i.checkContext()
+}
+
+// countSample 记录 DRAW 计算的一个采样点
+func (i *Interpreter) countSample() error {
+	i.samples++
+	if max := i.Limits.MaxSamples; max > 0 && i.samples > max {
+		return limitf("Sample limit of %d exceeded", max)
+	}
+	return nil
+}
+
+// checkPixels 检查输出图像的大小
+func (i *Interpreter) checkPixels(width, height int) error {
+	if max := i.Limits.MaxPixels; max > 0 && width*height > max {
+		return limitf("Image of %dx%d pixels exceeds the limit of %d pixels", width, height, max)
+	}
+	return nil
+}
@@ -1,27 +1,40 @@
 package lexer
 
 import (
+	"compilers/builtin"
 	"compilers/token"
 	"unicode"
 )
 
 // Lexer represents the lexical analyzer.
 type Lexer struct {
+	filename     string
 	input        string
 	position     int
 	readPosition int
 	ch           rune
+	line         int // line of the current character, 1-based
+	column       int // column of the current character, 1-based
 }
 
 // New creates a new Lexer instance.
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+// NewFile creates a new Lexer whose token positions refer to filename.
+func NewFile(filename, input string) *Lexer {
+	l := &Lexer{filename: filename, input: input, line: 1}
 	l.readChar()
 	return l
 }
 
 // readChar reads the next character from the input.
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
 	if l.readPosition >= len(l.input) {
 		l.ch = 0 // 0 represents EOF
 	} else {
@@ -29,24 +42,44 @@ func (l *Lexer) readChar() {
 	}
 	l.position = l.readPosition
 	l.readPosition++
+	l.column++
+}
+
+// pos returns the position of the current character.
+func (l *Lexer) pos() token.Pos {
+	return token.Pos{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.column,
+	}
 }
 
 // NextToken lexes the next token and advances the lexer state.
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
-
 	l.skipWhitespace()
 
+	start := l.pos()
+	tok := l.scan()
+	tok.Start = start
+	tok.End = l.pos()
+	return tok
+}
+
+// scan reads the token starting at the current character.
+func (l *Lexer) scan() token.Token {
+	var tok token.Token
+
 	switch l.ch {
 	case '/':
 		if l.peekChar() == '/' { // 处理注释 //
-			tok = token.New(token.COMMENT, l.readComment())
+			return token.New(token.COMMENT, l.readComment())
 		} else { // 单独的 /
 			tok = token.New(token.DIV, string(l.ch))
 		}
 	case '-':
 		if l.peekChar() == '-' { // 处理注释 --
-			tok = token.New(token.COMMENT, l.readComment())
+			return token.New(token.COMMENT, l.readComment())
 		} else {
 			tok = token.New(token.MINUS, string(l.ch))
 		}
@@ -60,7 +93,33 @@ func (l *Lexer) NextToken() token.Token {
 			tok = token.New(token.MUL, string(l.ch))
 		}
 	case '=':
-		tok = token.New(token.ASSIGN, string(l.ch))
+		if l.peekChar() == '=' { // 处理比较运算符 ==
+			l.readChar()
+			tok = token.New(token.EQ, "==")
+		} else {
+			tok = token.New(token.ASSIGN, string(l.ch))
+		}
+	case '!':
+		if l.peekChar() == '=' { // 处理比较运算符 !=
+			l.readChar()
+			tok = token.New(token.NE, "!=")
+		} else {
+			tok = token.New(token.ILLEGAL, string(l.ch))
+		}
+	case '<':
+		if l.peekChar() == '=' { // 处理比较运算符 <=
+			l.readChar()
+			tok = token.New(token.LE, "<=")
+		} else {
+			tok = token.New(token.LT, string(l.ch))
+		}
+	case '>':
+		if l.peekChar() == '=' { // 处理比较运算符 >=
+			l.readChar()
+			tok = token.New(token.GE, ">=")
+		} else {
+			tok = token.New(token.GT, string(l.ch))
+		}
 	case ',':
 		tok = token.New(token.COMMA, string(l.ch))
 	case ';':
@@ -69,8 +128,15 @@ func (l *Lexer) NextToken() token.Token {
 		tok = token.New(token.L_BRACKET, string(l.ch))
 	case ')':
 		tok = token.New(token.R_BRACKET, string(l.ch))
+	case '{':
+		tok = token.New(token.L_BRACE, string(l.ch))
+	case '}':
+		tok = token.New(token.R_BRACE, string(l.ch))
+	case '"':
+		return l.readString()
 	case 0:
-		tok = token.New(token.EOF, "")
+		// Stay on EOF so that repeated calls report the same position.
+		return token.New(token.EOF, "")
 	default:
 		if isLetter(l.ch) {
 			ident := l.readIdentifier()
@@ -107,6 +173,27 @@ func (l *Lexer) readComment() string {
 	return l.input[start:l.position]
 }
 
+// readString reads a double-quoted string literal with Go-style escapes.
+// A string that is not closed on the same line is ILLEGAL.
+func (l *Lexer) readString() token.Token {
+	start := l.position
+	l.readChar() // skip opening quote
+	for l.ch != '"' {
+		if l.ch == '\n' || l.ch == 0 {
+			return token.New(token.ILLEGAL, l.input[start:l.position])
+		}
+		if l.ch == '\\' {
+			l.readChar()
+			if l.ch == '\n' || l.ch == 0 {
+				continue
+			}
+		}
+		l.readChar()
+	}
+	l.readChar() // skip closing quote
+	return token.New(token.STRING, l.input[start:l.position])
+}
+
 // readIdentifier reads an identifier (variable, function name, etc.).
 func (l *Lexer) readIdentifier() string {
 	start := l.position
@@ -116,8 +203,8 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[start:l.position]
 }
 
-// readNumber reads a number (integer or float).
-// readNumber reads a number (integer or float), handling cases like "100/3".
+// readNumber reads a number (integer or float). "100/3" is lexed as a division
+// so that it obeys the usual precedence, e.g. 2**1/2 = (2**1)/2.
 func (l *Lexer) readNumber() string {
 	start := l.position
 	// First, read the integer part
@@ -131,13 +218,6 @@ func (l *Lexer) readNumber() string {
 			l.readChar()
 		}
 	}
-	// Handle division operator within numbers
-	if l.ch == '/' {
-		l.readChar()
-		for isDigit(l.ch) {
-			l.readChar()
-		}
-	}
 	return l.input[start:l.position]
 }
 
@@ -159,40 +239,17 @@ func isDigit(ch rune) bool {
 	return unicode.IsDigit(ch)
 }
 
-// lookupKeyword checks if an identifier is a keyword or function.
+// lookupKeyword checks if an identifier is a keyword or built-in function.
 func lookupKeyword(ident string) token.TokenType {
-	// Check for specific constants like PI, E, etc.
-	constants := map[string]token.TokenType{
-		"PI": token.CONST_ID,
-		"E":  token.CONST_ID,
-		// Add any other predefined constants here
-	}
-
-	if tok, ok := constants[ident]; ok {
+	// Constants like PI and E and keywords take precedence over functions
+	if tok, ok := token.Keyword(ident); ok {
 		return tok
 	}
 
-	// Check for keywords and math functions
-	keywords := map[string]token.TokenType{
-		"ORIGIN": token.ORIGIN,
-		"IS":     token.IS,
-		"SCALE":  token.SCALE,
-		"ROT":    token.ROT,
-		"FOR":    token.FOR,
-		"FROM":   token.FROM,
-		"TO":     token.TO,
-		"STEP":   token.STEP,
-		"DRAW":   token.DRAW,
-		"SIN":    token.SIN,
-		"COS":    token.COS,
-		"TAN":    token.TAN,
-		"SQRT":   token.SQRT,
-		"EXP":    token.EXP,
-		"LN":     token.LN,
-	}
-
-	if tok, ok := keywords[ident]; ok {
-		return tok
+	// Math functions come from the builtin registry, including ones
+	// registered by the embedding program
+	if _, ok := builtin.Lookup(ident); ok {
+		return token.BUILTIN
 	}
 
 	// Default to ID for generic identifiers
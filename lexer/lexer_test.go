@@ -28,7 +28,9 @@ func TestLexer(t *testing.T) {
 				{Type: token.L_BRACKET, Literal: "("},
 				{Type: token.CONST_ID, Literal: "100"},
 				{Type: token.COMMA, Literal: ","},
-				{Type: token.CONST_ID, Literal: "100/3"},
+				{Type: token.CONST_ID, Literal: "100"},
+				{Type: token.DIV, Literal: "/"},
+				{Type: token.CONST_ID, Literal: "3"},
 				{Type: token.R_BRACKET, Literal: ")"},
 				{Type: token.SEMICO, Literal: ";"},
 				{Type: token.ROT, Literal: "ROT"},
@@ -66,6 +68,46 @@ func TestLexer(t *testing.T) {
 				{Type: token.ASSIGN, Literal: "="},
 			},
 		},
+		{
+			// Test comparison and logical operators
+			input: "< <= > >= == != = AND OR NOT IF THEN ELSE",
+			expected: []token.Token{
+				{Type: token.LT, Literal: "<"},
+				{Type: token.LE, Literal: "<="},
+				{Type: token.GT, Literal: ">"},
+				{Type: token.GE, Literal: ">="},
+				{Type: token.EQ, Literal: "=="},
+				{Type: token.NE, Literal: "!="},
+				{Type: token.ASSIGN, Literal: "="},
+				{Type: token.AND, Literal: "AND"},
+				{Type: token.OR, Literal: "OR"},
+				{Type: token.NOT, Literal: "NOT"},
+				{Type: token.IF, Literal: "IF"},
+				{Type: token.THEN, Literal: "THEN"},
+				{Type: token.ELSE, Literal: "ELSE"},
+			},
+		},
+		{
+			// Test built-in function names
+			input: "SIN ATAN2 LOG10 MAX sin",
+			expected: []token.Token{
+				{Type: token.BUILTIN, Literal: "SIN"},
+				{Type: token.BUILTIN, Literal: "ATAN2"},
+				{Type: token.BUILTIN, Literal: "LOG10"},
+				{Type: token.BUILTIN, Literal: "MAX"},
+				{Type: token.ID, Literal: "sin"},
+			},
+		},
+		{
+			// Test block delimiters
+			input: "BEGIN END { }",
+			expected: []token.Token{
+				{Type: token.BEGIN, Literal: "BEGIN"},
+				{Type: token.END, Literal: "END"},
+				{Type: token.L_BRACE, Literal: "{"},
+				{Type: token.R_BRACE, Literal: "}"},
+			},
+		},
 		{
 			// Test identifier recognition
 			input: "myVar PI someVar",
@@ -75,6 +117,50 @@ func TestLexer(t *testing.T) {
 				{Type: token.ID, Literal: "someVar"},
 			},
 		},
+		{
+			// Test transform keywords
+			input: "SHEAR REFLECT TRANSFORM CUMULATIVE PUSH POP",
+			expected: []token.Token{
+				{Type: token.SHEAR, Literal: "SHEAR"},
+				{Type: token.REFLECT, Literal: "REFLECT"},
+				{Type: token.TRANSFORM, Literal: "TRANSFORM"},
+				{Type: token.ID, Literal: "CUMULATIVE"},
+				{Type: token.PUSH, Literal: "PUSH"},
+				{Type: token.POP, Literal: "POP"},
+			},
+		},
+		{
+			// Test adaptive sampling keywords
+			input: "STEP ADAPTIVE TOLERANCE 0.5",
+			expected: []token.Token{
+				{Type: token.STEP, Literal: "STEP"},
+				{Type: token.ADAPTIVE, Literal: "ADAPTIVE"},
+				{Type: token.TOLERANCE, Literal: "TOLERANCE"},
+				{Type: token.CONST_ID, Literal: "0.5"},
+			},
+		},
+		{
+			// Test line style keywords; LINES, MITER etc. are identifiers
+			input: "WIDTH JOIN CAP LINES MITER",
+			expected: []token.Token{
+				{Type: token.WIDTH, Literal: "WIDTH"},
+				{Type: token.JOIN, Literal: "JOIN"},
+				{Type: token.CAP, Literal: "CAP"},
+				{Type: token.ID, Literal: "LINES"},
+				{Type: token.ID, Literal: "MITER"},
+			},
+		},
+		{
+			// Test string literals; an unterminated string is ILLEGAL
+			input: `OUTPUT IS "a b.png" "q\"x" "open`,
+			expected: []token.Token{
+				{Type: token.OUTPUT, Literal: "OUTPUT"},
+				{Type: token.IS, Literal: "IS"},
+				{Type: token.STRING, Literal: `"a b.png"`},
+				{Type: token.STRING, Literal: `"q\"x"`},
+				{Type: token.ILLEGAL, Literal: `"open`},
+			},
+		},
 		{
 			// Test numeric values
 			input: "123 45.67 0.89",
@@ -95,7 +181,7 @@ func TestLexer(t *testing.T) {
 				if tok.Type == token.EOF {
 					break
 				}
-				tokens = append(tokens, tok)
+				tokens = append(tokens, token.New(tok.Type, tok.Literal))
 			}
 
 			if !reflect.DeepEqual(tokens, tt.expected) {
@@ -104,3 +190,40 @@ func TestLexer(t *testing.T) {
 		})
 	}
 }
+
+func TestLexerPositions(t *testing.T) {
+	input := "ORIGIN IS (1, 2);\n// comment\n  ROT IS PI;"
+	expected := []struct {
+		literal string
+		start   token.Pos
+		end     token.Pos
+	}{
+		{"ORIGIN", token.Pos{Filename: "a.mygo", Offset: 0, Line: 1, Column: 1}, token.Pos{Filename: "a.mygo", Offset: 6, Line: 1, Column: 7}},
+		{"IS", token.Pos{Filename: "a.mygo", Offset: 7, Line: 1, Column: 8}, token.Pos{Filename: "a.mygo", Offset: 9, Line: 1, Column: 10}},
+		{"(", token.Pos{Filename: "a.mygo", Offset: 10, Line: 1, Column: 11}, token.Pos{Filename: "a.mygo", Offset: 11, Line: 1, Column: 12}},
+		{"1", token.Pos{Filename: "a.mygo", Offset: 11, Line: 1, Column: 12}, token.Pos{Filename: "a.mygo", Offset: 12, Line: 1, Column: 13}},
+		{",", token.Pos{Filename: "a.mygo", Offset: 12, Line: 1, Column: 13}, token.Pos{Filename: "a.mygo", Offset: 13, Line: 1, Column: 14}},
+		{"2", token.Pos{Filename: "a.mygo", Offset: 14, Line: 1, Column: 15}, token.Pos{Filename: "a.mygo", Offset: 15, Line: 1, Column: 16}},
+		{")", token.Pos{Filename: "a.mygo", Offset: 15, Line: 1, Column: 16}, token.Pos{Filename: "a.mygo", Offset: 16, Line: 1, Column: 17}},
+		{";", token.Pos{Filename: "a.mygo", Offset: 16, Line: 1, Column: 17}, token.Pos{Filename: "a.mygo", Offset: 17, Line: 1, Column: 18}},
+		{"// comment", token.Pos{Filename: "a.mygo", Offset: 18, Line: 2, Column: 1}, token.Pos{Filename: "a.mygo", Offset: 28, Line: 2, Column: 11}},
+		{"ROT", token.Pos{Filename: "a.mygo", Offset: 31, Line: 3, Column: 3}, token.Pos{Filename: "a.mygo", Offset: 34, Line: 3, Column: 6}},
+		{"IS", token.Pos{Filename: "a.mygo", Offset: 35, Line: 3, Column: 7}, token.Pos{Filename: "a.mygo", Offset: 37, Line: 3, Column: 9}},
+		{"PI", token.Pos{Filename: "a.mygo", Offset: 38, Line: 3, Column: 10}, token.Pos{Filename: "a.mygo", Offset: 40, Line: 3, Column: 12}},
+		{";", token.Pos{Filename: "a.mygo", Offset: 40, Line: 3, Column: 12}, token.Pos{Filename: "a.mygo", Offset: 41, Line: 3, Column: 13}},
+		{"", token.Pos{Filename: "a.mygo", Offset: 41, Line: 3, Column: 13}, token.Pos{Filename: "a.mygo", Offset: 41, Line: 3, Column: 13}},
+	}
+
+	lexer := NewFile("a.mygo", input)
+	for i, want := range expected {
+		tok := lexer.NextToken()
+		if tok.Literal != want.literal || tok.Start != want.start || tok.End != want.end {
+			t.Errorf("token %d: expected %q at %v-%v, but got %q at %v-%v",
+				i, want.literal, want.start, want.end, tok.Literal, tok.Start, tok.End)
+		}
+	}
+
+	if got := expected[9].start.String(); got != "a.mygo:3:3" {
+		t.Errorf("expected position string a.mygo:3:3, but got %s", got)
+	}
+}
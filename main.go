@@ -4,17 +4,32 @@ import (
 	"compilers/interpreter"
 	"compilers/lexer"
 	"compilers/parser"
+	"compilers/render"
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
 )
 
 func main() {
+	// "mygo render" turns a saved display list into an image
+	if len(os.Args) > 1 && os.Args[1] == "render" {
+		renderCommand(os.Args[2:])
+		return
+	}
+
 	// Parse command-line arguments
+	format := flag.Bool("fmt", false, "print the program in canonical form instead of running it")
+	output := flag.String("o", interpreter.DefaultOutput, "image file written at the end unless nothing was drawn after the last OUTPUT statement")
+	imageFormat := flag.String("format", "", "format of -o: png, svg, pdf, eps or jsonl (default: from the file extension)")
+	timeout := flag.Duration("timeout", 0, "stop the program after this long, e.g. 10s (default: no limit)")
 	flag.Parse()
 	if len(flag.Args()) < 1 {
-		log.Fatalf("Usage: %s <path to .mygo file>", os.Args[0])
+		log.Fatalf("Usage: %s [flags] <path to .mygo file>\n       %s render [flags] <path to .jsonl file>", os.Args[0], os.Args[0])
 	}
 	filePath := flag.Arg(0)
 
@@ -28,12 +43,90 @@ func main() {
 	input := string(code)
 
 	// Create the lexer
-	l := lexer.New(input)
+	l := lexer.NewFile(filePath, input)
 
 	// Create the parser
 	p := parser.New(l)
 
+	// Print the formatted program without executing it
+	if *format {
+		statements, diagnostics := p.ParseProgram()
+		if len(diagnostics) > 0 {
+			report(diagnostics)
+		}
+		if err := parser.Fprint(os.Stdout, statements); err != nil {
+			log.Fatalf("Failed to write output: %v", err)
+		}
+		return
+	}
+
 	// Create and execute the interpreter
 	i := interpreter.NewInterpreter(p)
-	i.Interpret()
+	i.Output = *output
+	i.Limits.MaxTime = *timeout
+	if *imageFormat != "" {
+		i.Format, err = render.ParseFormat(*imageFormat)
+	} else {
+		_, err = render.FormatOf(*output)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Ctrl-C stops the program cleanly instead of killing it mid-write
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := i.Interpret(ctx); err != nil {
+		var list parser.ErrorList
+		if errors.As(err, &list) {
+			report(list)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// renderCommand draws a display list saved in JSONL format to an image,
+// optionally at another resolution
+func renderCommand(args []string) {
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	output := flags.String("o", interpreter.DefaultOutput, "output file")
+	outputFormat := flags.String("format", "", "format of -o: png, svg, pdf, eps or jsonl (default: from the file extension)")
+	scale := flags.Float64("scale", 1, "scale the canvas and device coordinates by this factor")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		log.Fatalf("Usage: %s render [flags] <path to .jsonl file>", os.Args[0])
+	}
+
+	var format render.Format
+	var err error
+	if *outputFormat != "" {
+		format, err = render.ParseFormat(*outputFormat)
+	} else {
+		format, err = render.FormatOf(*output)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *scale <= 0 {
+		log.Fatalf("Invalid scale %v, expected a positive number", *scale)
+	}
+
+	list, err := render.ReadFile(flags.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to read display list: %v", err)
+	}
+	if *scale != 1 {
+		list = list.Scale(*scale)
+	}
+	if err := list.WriteFile(*output, format); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// report prints the diagnostics to stderr and exits with status 1
+func report(diagnostics []parser.Diagnostic) {
+	for _, d := range diagnostics {
+		fmt.Fprintln(os.Stderr, d.Error())
+	}
+	os.Exit(1)
 }
@@ -0,0 +1,134 @@
+// Package mygo 把绘图语言嵌入 Go 程序：Compile 解析并检查一次源代码，
+// 得到的 Program 可以用不同的画布大小、背景、图像格式和注入的变量反复渲染。
+//
+// 渲染完全在内存中进行，不读写文件，也不输出执行过程的信息；程序中的 OUTPUT 语句被忽略，
+// 结果总是程序结束时的整张画布
+package mygo
+
+import (
+	"bytes"
+	"compilers/interpreter"
+	"compilers/lexer"
+	"compilers/parser"
+	"compilers/render"
+	"compilers/semantic"
+	"compilers/token"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"slices"
+)
+
+// Program 是编译好的程序，编译之后不再改变。
+// 同一个 Program 可以在多个 goroutine 中同时渲染，每次渲染使用一个独立的解释器
+type Program struct {
+	statements []parser.Statement
+	variables  []string // Compile 时声明的注入变量
+}
+
+// Compile 解析并检查源代码 src。variables 是渲染时通过 Options.Variables 注入的变量名，
+// 程序可以直接使用这些变量而不必先赋值。
+// 源代码有语法错误或语义错误时返回包含全部诊断信息的 parser.ErrorList
+func Compile(src string, variables ...string) (*Program, error) {
+	for _, name := range variables {
+		if !isIdentifier(name) {
+			return nil, fmt.Errorf("Cannot inject variable %q, expected an identifier that is not a keyword, function or constant", name)
+		}
+	}
+	statements, diagnostics := parser.New(lexer.New(src)).ParseProgram()
+	if len(diagnostics) > 0 {
+		return nil, parser.ErrorList(diagnostics)
+	}
+	if diagnostics := semantic.Check(statements, variables...); len(diagnostics) > 0 {
+		return nil, parser.ErrorList(diagnostics)
+	}
+	return &Program{statements: statements, variables: slices.Clone(variables)}, nil
+}
+
+// isIdentifier 判断 name 是否会被词法分析为一个普通的标识符
+func isIdentifier(name string) bool {
+	l := lexer.New(name)
+	tok := l.NextToken()
+	return tok.Type == token.ID && tok.Literal == name && l.NextToken().Type == token.EOF
+}
+
+// Options 是一次渲染的选项，零值表示 800x600 像素、白色背景的 PNG 图像
+type Options struct {
+	Width      int                // 画布宽度，单位为像素，为零时使用 semantic.CanvasWidth
+	Height     int                // 画布高度，单位为像素，为零时使用 semantic.CanvasHeight
+	Background color.Color        // 背景颜色，为 nil 时为白色，color.Transparent 表示透明背景
+	Format     render.Format      // Render 返回的图像格式，为空时为 PNG；render.JSONL 返回显示列表
+	Variables  map[string]float64 // 注入的变量，名字必须在 Compile 时给出；没有给出值的变量在使用时出错
+	Limits     interpreter.Limits // 执行的资源限制
+}
+
+// Render 执行程序，返回按 opts.Format 编码的图像
+func (p *Program) Render(ctx context.Context, opts Options) ([]byte, error) {
+	format := opts.Format
+	if format == "" {
+		format = render.PNG
+	}
+	if _, err := render.ParseFormat(string(format)); err != nil {
+		return nil, err
+	}
+	list, err := p.run(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := list.Write(&buf, format, background(opts)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderImage 执行程序，返回栅格图像，opts.Format 不起作用
+func (p *Program) RenderImage(ctx context.Context, opts Options) (image.Image, error) {
+	list, err := p.run(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return list.Image(background(opts)), nil
+}
+
+// DisplayList 执行程序，返回画出的显示列表，可以之后再以任意格式输出
+func (p *Program) DisplayList(ctx context.Context, opts Options) (*render.DisplayList, error) {
+	return p.run(ctx, opts)
+}
+
+// run 在一个新的解释器中执行程序
+func (p *Program) run(ctx context.Context, opts Options) (*render.DisplayList, error) {
+	if opts.Width < 0 || opts.Height < 0 {
+		return nil, fmt.Errorf("Invalid canvas size %dx%d", opts.Width, opts.Height)
+	}
+	for name := range opts.Variables {
+		if !slices.Contains(p.variables, name) {
+			return nil, fmt.Errorf("Variable %s is not declared in Compile", name)
+		}
+	}
+
+	i := interpreter.NewProgramInterpreter(p.statements)
+	i.Sink = discard{}
+	i.Log = nil
+	i.Width, i.Height = opts.Width, opts.Height
+	i.Variables = opts.Variables
+	i.Limits = opts.Limits
+	if err := i.Interpret(ctx); err != nil {
+		return nil, err
+	}
+	return i.DisplayList(), nil
+}
+
+// background 返回 opts 中的背景颜色
+func background(opts Options) color.Color {
+	if opts.Background == nil {
+		return color.White
+	}
+	return opts.Background
+}
+
+// discard 忽略 OUTPUT 语句
+type discard struct{}
+
+func (discard) Save(string, render.Format, *render.DisplayList) error { return nil }
@@ -0,0 +1,184 @@
+package mygo
+
+import (
+	"bytes"
+	"compilers/interpreter"
+	"compilers/parser"
+	"compilers/render"
+	"context"
+	"errors"
+	"image/color"
+	"image/png"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		src       string
+		variables []string
+		err       string
+	}{
+		{src: "ROT IS ;", err: "1:8: Unexpected token in atom: ;"},
+		{src: "ROT IS a;", err: "1:8: Undefined variable: a"},
+		{src: "ROT IS a;", variables: []string{"PI"}, err: `Cannot inject variable "PI", expected an identifier that is not a keyword, function or constant`},
+		{src: "ROT IS a;", variables: []string{"a b"}, err: `Cannot inject variable "a b", expected an identifier that is not a keyword, function or constant`},
+		{src: "ROT IS a;", variables: []string{"SIN"}, err: `Cannot inject variable "SIN", expected an identifier that is not a keyword, function or constant`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := Compile(tt.src, tt.variables...)
+			if err == nil || err.Error() != tt.err {
+				t.Fatalf("expected error %q, but got %v", tt.err, err)
+			}
+		})
+	}
+
+	_, err := Compile("ROT IS a;")
+	var list parser.ErrorList
+	if !errors.As(err, &list) {
+		t.Errorf("expected a parser.ErrorList, but got %#v", err)
+	}
+}
+
+// 同一个程序以不同的选项渲染
+func TestRender(t *testing.T) {
+	prog, err := Compile("ORIGIN IS (x0, 20);\nOUTPUT IS \"ignored.png\";\nFOR T FROM 0 TO 1 STEP 1 DRAW (T, 0);", "x0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	img, err := prog.RenderImage(ctx, Options{Width: 40, Height: 30, Variables: map[string]float64{"x0": 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 40 || b.Dy() != 30 {
+		t.Errorf("expected a 40x30 image, but got %v", b)
+	}
+	if r, _, _, _ := img.At(10, 20).RGBA(); r > 0x8000 {
+		t.Errorf("expected a point at (10, 20)")
+	}
+
+	// 注入的变量改变画出的位置，背景透明
+	img, err = prog.RenderImage(ctx, Options{Width: 40, Height: 30, Background: color.Transparent, Variables: map[string]float64{"x0": 30}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := color.NRGBAModel.Convert(img.At(10, 20)); got != (color.NRGBA{}) {
+		t.Errorf("expected a transparent pixel at (10, 20), but got %v", got)
+	}
+	if _, _, _, a := img.At(30, 20).RGBA(); a == 0 {
+		t.Errorf("expected a point at (30, 20)")
+	}
+
+	data, err := prog.Render(ctx, Options{Variables: map[string]float64{"x0": 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := decoded.Bounds(); b.Dx() != 800 || b.Dy() != 600 {
+		t.Errorf("expected an 800x600 image, but got %v", b)
+	}
+
+	data, err = prog.Render(ctx, Options{Format: render.SVG, Variables: map[string]float64{"x0": 10}})
+	if err != nil || !strings.HasPrefix(string(data), "<?xml") {
+		t.Errorf("expected an SVG image, but got %.20q, %v", data, err)
+	}
+
+	data, err = prog.Render(ctx, Options{Format: render.JSONL, Variables: map[string]float64{"x0": 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := render.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Ops) != 2 {
+		t.Errorf("expected 2 points, but got %d ops", len(list.Ops))
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	prog, err := Compile("FOR T FROM 0 TO 1000000 STEP 1 DRAW (T, a);", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		opts Options
+		err  string
+		is   error
+	}{
+		{"undeclared", ctx, Options{Variables: map[string]float64{"b": 1}}, "Variable b is not declared in Compile", nil},
+		{"missing", ctx, Options{}, "1:41: Undefined variable: a", nil},
+		{"format", ctx, Options{Format: "gif"}, `Unknown image format "gif", expected one of png, svg, pdf, eps, jsonl`, nil},
+		{"size", ctx, Options{Width: -1}, "Invalid canvas size -1x0", nil},
+		{"limit", ctx, Options{Variables: map[string]float64{"a": 1}, Limits: interpreter.Limits{MaxSamples: 10}},
+			"1:32: Sample limit of 10 exceeded", interpreter.ErrLimit},
+		{"pixels", ctx, Options{Width: 2000, Height: 2000, Limits: interpreter.Limits{MaxPixels: 1000000}},
+			"Image of 2000x2000 pixels exceeds the limit of 1000000 pixels", interpreter.ErrLimit},
+		{"canceled", canceled, Options{Variables: map[string]float64{"a": 1}},
+			"1:1: Execution canceled: context canceled", context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := prog.Render(tt.ctx, tt.opts)
+			if err == nil || err.Error() != tt.err {
+				t.Fatalf("expected error %q, but got %v", tt.err, err)
+			}
+			if tt.is != nil && !errors.Is(err, tt.is) {
+				t.Errorf("expected errors.Is(err, %v)", tt.is)
+			}
+		})
+	}
+}
+
+// 同一个 Program 在多个 goroutine 中同时渲染，结果与依次渲染相同
+func TestRenderConcurrent(t *testing.T) {
+	src := "FUNC f(t) = a * SIN(t);\nb = 0;\n" +
+		"FOR T FROM 0 TO 2*PI STEP ADAPTIVE BEGIN b = b + 1; DRAW (T * 50, f(T) + b / 100); END;\n" +
+		"OUTPUT IS \"ignored.png\";\nFOR T FROM 0 TO a STEP 1 DRAW (T, -T);"
+	prog, err := Compile(src, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	const n = 8
+	expected := make([][]byte, n)
+	for k := range expected {
+		if expected[k], err = prog.Render(ctx, Options{Format: render.JSONL, Variables: map[string]float64{"a": float64(k * 10)}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	got := make([][]byte, n*4)
+	errs := make([]error, len(got))
+	for k := range got {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got[k], errs[k] = prog.Render(ctx, Options{Format: render.JSONL, Variables: map[string]float64{"a": float64(k % n * 10)}})
+		}()
+	}
+	wg.Wait()
+	for k := range got {
+		if errs[k] != nil {
+			t.Fatalf("render %d: unexpected error %v", k, errs[k])
+		}
+		if !bytes.Equal(got[k], expected[k%n]) {
+			t.Errorf("render %d differs from the sequential render with a = %d", k, k%n*10)
+		}
+	}
+}
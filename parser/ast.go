@@ -0,0 +1,248 @@
+// Package parser 把源程序解析为抽象语法树。
+//
+// 语法树只描述程序的结构和源代码位置，不包含求值逻辑。解释器、语义检查、
+// 格式化等都是独立的遍历过程，通过类型分支或者 Walk / Inspect 访问节点。
+package parser
+
+import "compilers/token"
+
+// Node is implemented by every statement and expression node.
+type Node interface {
+	Pos() token.Pos    // position of the first character of the node
+	EndPos() token.Pos // position of the first character after the node
+}
+
+// Statement is implemented by all statement nodes.
+type Statement interface {
+	Node
+	statementNode()
+}
+
+// Expression is implemented by all expression nodes.
+type Expression interface {
+	Node
+	expressionNode()
+}
+
+// Span records the source range covered by a node.
+type Span struct {
+	From token.Pos
+	To   token.Pos
+}
+
+// Pos returns the position of the first character of the node.
+func (s Span) Pos() token.Pos { return s.From }
+
+// EndPos returns the position of the first character after the node.
+func (s Span) EndPos() token.Pos { return s.To }
+
+// 表达式类型
+
+// VariableExpression represents a variable in an expression
+type VariableExpression struct {
+	Span
+	Name string
+}
+
+// ConstantExpression represents a constant value in an expression,
+// either a numeric literal or one of the named constants PI and E
+type ConstantExpression struct {
+	Span
+	Value string
+}
+
+// BinaryExpression represents a binary operation in an expression:
+// arithmetic, comparison (1 或 0) or AND / OR
+type BinaryExpression struct {
+	Span
+	Left     Expression
+	Right    Expression
+	Operator token.TokenType
+}
+
+// UnaryExpression represents a prefix operation: +, - or NOT
+type UnaryExpression struct {
+	Span
+	Operator token.TokenType
+	Operand  Expression
+}
+
+// FunctionCallExpression represents a call to a built-in or user-defined function
+type FunctionCallExpression struct {
+	Span
+	Name      string
+	Arguments []Expression
+}
+
+func (*VariableExpression) expressionNode()     {}
+func (*ConstantExpression) expressionNode()     {}
+func (*BinaryExpression) expressionNode()       {}
+func (*UnaryExpression) expressionNode()        {}
+func (*FunctionCallExpression) expressionNode() {}
+
+// 语句类型
+type OriginStatement struct {
+	Span
+	X Expression
+	Y Expression
+}
+
+type ScaleStatement struct {
+	Span
+	X Expression
+	Y Expression
+}
+
+type RotStatement struct {
+	Span
+	Angle Expression
+}
+
+// ShearStatement 表示 SHEAR IS (横向错切系数, 纵向错切系数)
+type ShearStatement struct {
+	Span
+	X Expression
+	Y Expression
+}
+
+// ReflectStatement 表示 REFLECT IS 角度，以过原点、倾角为该角度的直线为轴反射
+type ReflectStatement struct {
+	Span
+	Angle Expression
+}
+
+// TransformStatement 表示 TRANSFORM IS (a, b, c, d, e, f)，直接给出仿射变换矩阵。
+// 与 DRAW 一样，分量个数由语义检查确认
+type TransformStatement struct {
+	Span
+	Components []Expression
+}
+
+// TransformModeStatement 表示 TRANSFORM IS CUMULATIVE 或 TRANSFORM IS ABSOLUTE
+type TransformModeStatement struct {
+	Span
+	Cumulative bool
+}
+
+// PushStatement 表示 PUSH，保存当前的坐标变换
+type PushStatement struct {
+	Span
+}
+
+// PopStatement 表示 POP，恢复最近一次 PUSH 保存的坐标变换
+type PopStatement struct {
+	Span
+}
+
+// DrawModeStatement 表示 DRAW IS LINES / DRAW IS POINTS。
+// LINES 把同一个 FOR 循环中同一条 DRAW 语句的相邻采样点连成折线，POINTS 为每个采样点画一个圆点
+type DrawModeStatement struct {
+	Span
+	Lines bool
+}
+
+// WidthStatement 表示 WIDTH IS 线宽，单位为像素
+type WidthStatement struct {
+	Span
+	Width Expression
+}
+
+// JoinStatement 表示 JOIN IS MITER / ROUND / BEVEL，折线拐角的样式
+type JoinStatement struct {
+	Span
+	Join string
+}
+
+// CapStatement 表示 CAP IS BUTT / ROUND / SQUARE，折线端点的样式
+type CapStatement struct {
+	Span
+	Cap string
+}
+
+// OutputStatement 表示 OUTPUT IS "文件名"，把画布上已经画出的内容写入文件
+type OutputStatement struct {
+	Span
+	Path string // 去掉引号和转义之后的文件名
+}
+
+type AssignmentStatement struct {
+	Span
+	Identifier string
+	Value      Expression
+}
+
+// DrawStatement 表示 DRAW (横坐标, 纵坐标)，只能出现在 FOR 循环体中。
+// 语法上允许任意个分量，语义检查保证恰好有两个
+type DrawStatement struct {
+	Span
+	Components []Expression
+}
+
+// BlockStatement 表示 BEGIN ... END 或 { ... } 包围的语句序列
+type BlockStatement struct {
+	Span
+	Statements []Statement
+}
+
+// IfStatement 表示 IF 条件 THEN 语句 [ELSE 语句]
+type IfStatement struct {
+	Span
+	Condition Expression
+	Then      Statement
+	Else      Statement // 没有 ELSE 分支时为 nil
+}
+
+// FunctionDeclaration 表示 FUNC 名字(参数, ...) = 表达式
+type FunctionDeclaration struct {
+	Span
+	Name   string
+	Params []string
+	Body   Expression
+}
+
+// ExpressionStatement 表示单独作为语句出现的表达式，例如 SIN(30);
+type ExpressionStatement struct {
+	Span
+	X Expression
+}
+
+// ForStatement 是 FOR 循环。STEP ADAPTIVE 时 Step 为 nil，采样点由解释器自适应地选取，
+// 使折线在屏幕上与曲线的偏差不超过 Tolerance 像素；Tolerance 为 nil 时使用默认值
+type ForStatement struct {
+	Span
+	LoopVar   string
+	Start     Expression
+	End       Expression
+	Step      Expression
+	Adaptive  bool
+	Tolerance Expression
+	Body      Statement
+}
+
+type CommentStatement struct {
+	Span
+	Text string
+}
+
+func (*OriginStatement) statementNode()        {}
+func (*ScaleStatement) statementNode()         {}
+func (*RotStatement) statementNode()           {}
+func (*ShearStatement) statementNode()         {}
+func (*ReflectStatement) statementNode()       {}
+func (*TransformStatement) statementNode()     {}
+func (*TransformModeStatement) statementNode() {}
+func (*PushStatement) statementNode()          {}
+func (*PopStatement) statementNode()           {}
+func (*DrawModeStatement) statementNode()      {}
+func (*WidthStatement) statementNode()         {}
+func (*JoinStatement) statementNode()          {}
+func (*CapStatement) statementNode()           {}
+func (*OutputStatement) statementNode()        {}
+func (*AssignmentStatement) statementNode()    {}
+func (*DrawStatement) statementNode()          {}
+func (*BlockStatement) statementNode()         {}
+func (*IfStatement) statementNode()            {}
+func (*FunctionDeclaration) statementNode()    {}
+func (*ExpressionStatement) statementNode()    {}
+func (*ForStatement) statementNode()           {}
+func (*CommentStatement) statementNode()       {}
@@ -0,0 +1,279 @@
+package parser
+
+import (
+	"compilers/token"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Fprint 把程序以规范的格式写回源代码：每条语句占一行并以 ";" 结束，
+// 语句块统一写成 BEGIN ... END，块内缩进一个制表符，表达式只保留必要的括号
+func Fprint(w io.Writer, statements []Statement) error {
+	var p printer
+	for _, stmt := range statements {
+		p.line(stmt)
+	}
+	_, err := io.WriteString(w, p.String())
+	return err
+}
+
+// Format 返回单个节点的源代码形式，语句末尾不带 ";"
+func Format(node Node) string {
+	var p printer
+	switch n := node.(type) {
+	case Statement:
+		p.stmt(n)
+	case Expression:
+		p.expr(n, precCondition)
+	}
+	return p.String()
+}
+
+// 表达式的优先级，数值越大结合越紧
+const (
+	precCondition  = iota + 1 // OR
+	precAnd                   // AND
+	precNot                   // NOT
+	precComparison            // < <= > >= == !=
+	precSum                   // + -
+	precProduct               // * /
+	precUnary                 // 一元 + -
+	precPower                 // **
+	precAtom                  // 常量、变量、函数调用
+)
+
+// 除 IF 条件和括号内部外，语法只接受算术表达式，比较和逻辑运算需要加括号
+const precExpression = precSum
+
+type printer struct {
+	strings.Builder
+	indent int
+}
+
+// line 输出一条独占一行的语句
+func (p *printer) line(s Statement) {
+	p.WriteString(strings.Repeat("\t", p.indent))
+	p.stmt(s)
+	if _, ok := s.(*CommentStatement); !ok {
+		p.WriteString(";")
+	}
+	p.WriteString("\n")
+}
+
+func (p *printer) stmt(s Statement) {
+	switch s := s.(type) {
+	case *OriginStatement:
+		p.WriteString("ORIGIN IS ")
+		p.pair(s.X, s.Y)
+	case *ScaleStatement:
+		p.WriteString("SCALE IS ")
+		p.pair(s.X, s.Y)
+	case *RotStatement:
+		p.WriteString("ROT IS ")
+		p.expr(s.Angle, precExpression)
+	case *ShearStatement:
+		p.WriteString("SHEAR IS ")
+		p.pair(s.X, s.Y)
+	case *ReflectStatement:
+		p.WriteString("REFLECT IS ")
+		p.expr(s.Angle, precExpression)
+	case *TransformStatement:
+		p.WriteString("TRANSFORM IS ")
+		p.list(s.Components)
+	case *TransformModeStatement:
+		if s.Cumulative {
+			p.WriteString("TRANSFORM IS " + modeCumulative)
+		} else {
+			p.WriteString("TRANSFORM IS " + modeAbsolute)
+		}
+	case *PushStatement:
+		p.WriteString("PUSH")
+	case *PopStatement:
+		p.WriteString("POP")
+	case *DrawModeStatement:
+		if s.Lines {
+			p.WriteString("DRAW IS " + drawLines)
+		} else {
+			p.WriteString("DRAW IS " + drawPoints)
+		}
+	case *WidthStatement:
+		p.WriteString("WIDTH IS ")
+		p.expr(s.Width, precExpression)
+	case *JoinStatement:
+		p.WriteString("JOIN IS " + s.Join)
+	case *CapStatement:
+		p.WriteString("CAP IS " + s.Cap)
+	case *OutputStatement:
+		p.WriteString("OUTPUT IS " + strconv.Quote(s.Path))
+	case *AssignmentStatement:
+		p.WriteString(s.Identifier + " = ")
+		p.expr(s.Value, precExpression)
+	case *DrawStatement:
+		p.WriteString("DRAW ")
+		p.list(s.Components)
+	case *BlockStatement:
+		p.WriteString("BEGIN\n")
+		p.indent++
+		for _, stmt := range s.Statements {
+			p.line(stmt)
+		}
+		p.indent--
+		p.WriteString(strings.Repeat("\t", p.indent) + "END")
+	case *IfStatement:
+		p.WriteString("IF ")
+		p.expr(s.Condition, precCondition)
+		p.WriteString(" THEN ")
+		if s.Else != nil && endsWithOpenIf(s.Then) {
+			// 加上 BEGIN ... END，否则 ELSE 会与内层的 IF 匹配
+			p.stmt(&BlockStatement{Statements: []Statement{s.Then}})
+		} else {
+			p.stmt(s.Then)
+		}
+		if s.Else != nil {
+			p.WriteString(" ELSE ")
+			p.stmt(s.Else)
+		}
+	case *FunctionDeclaration:
+		fmt.Fprintf(p, "FUNC %s(%s) = ", s.Name, strings.Join(s.Params, ", "))
+		p.expr(s.Body, precExpression)
+	case *ExpressionStatement:
+		p.expr(s.X, precExpression)
+	case *ForStatement:
+		fmt.Fprintf(p, "FOR %s FROM ", s.LoopVar)
+		p.expr(s.Start, precExpression)
+		p.WriteString(" TO ")
+		p.expr(s.End, precExpression)
+		p.WriteString(" STEP ")
+		if s.Adaptive {
+			p.WriteString("ADAPTIVE")
+			if s.Tolerance != nil {
+				p.WriteString(" TOLERANCE ")
+				p.expr(s.Tolerance, precExpression)
+			}
+		} else {
+			p.expr(s.Step, precExpression)
+		}
+		p.WriteString(" ")
+		p.stmt(s.Body)
+	case *CommentStatement:
+		p.WriteString(s.Text)
+	default:
+		panic(fmt.Sprintf("parser.Format: unexpected statement type %T", s))
+	}
+}
+
+// pair 输出 (x, y)
+func (p *printer) pair(x, y Expression) {
+	p.list([]Expression{x, y})
+}
+
+// list 输出括号内以逗号分隔的表达式
+func (p *printer) list(list []Expression) {
+	p.WriteString("(")
+	for k, e := range list {
+		if k > 0 {
+			p.WriteString(", ")
+		}
+		p.expr(e, precExpression)
+	}
+	p.WriteString(")")
+}
+
+// expr 输出表达式；表达式的优先级低于 min 时加上括号
+func (p *printer) expr(e Expression, min int) {
+	if precedence(e) < min {
+		p.WriteString("(")
+		defer p.WriteString(")")
+	}
+
+	switch e := e.(type) {
+	case *VariableExpression:
+		p.WriteString(e.Name)
+	case *ConstantExpression:
+		p.WriteString(e.Value)
+	case *BinaryExpression:
+		left, right := operandPrecedence(e.Operator)
+		p.expr(e.Left, left)
+		p.WriteString(" " + string(e.Operator) + " ")
+		p.expr(e.Right, right)
+	case *UnaryExpression:
+		if e.Operator == token.NOT {
+			p.WriteString("NOT ")
+			p.expr(e.Operand, precNot)
+			return
+		}
+		p.WriteString(string(e.Operator))
+		// "--" 会被当作注释，连续的正负号之间需要空格
+		if u, ok := e.Operand.(*UnaryExpression); ok && u.Operator != token.NOT {
+			p.WriteString(" ")
+		}
+		p.expr(e.Operand, precUnary)
+	case *FunctionCallExpression:
+		p.WriteString(e.Name)
+		p.list(e.Arguments)
+	default:
+		panic(fmt.Sprintf("parser.Format: unexpected expression type %T", e))
+	}
+}
+
+// precedence 返回表达式最外层运算的优先级
+func precedence(e Expression) int {
+	switch e := e.(type) {
+	case *BinaryExpression:
+		switch e.Operator {
+		case token.OR:
+			return precCondition
+		case token.AND:
+			return precAnd
+		case token.LT, token.LE, token.GT, token.GE, token.EQ, token.NE:
+			return precComparison
+		case token.PLUS, token.MINUS:
+			return precSum
+		case token.MUL, token.DIV:
+			return precProduct
+		case token.POWER:
+			return precPower
+		}
+	case *UnaryExpression:
+		if e.Operator == token.NOT {
+			return precNot
+		}
+		return precUnary
+	}
+	return precAtom
+}
+
+// operandPrecedence 返回二元运算左右两侧的表达式不加括号时所需的最低优先级，
+// 与语法分析器中各层的递归方式一致
+func operandPrecedence(op token.TokenType) (left, right int) {
+	switch op {
+	case token.OR:
+		return precCondition, precAnd
+	case token.AND:
+		return precAnd, precNot
+	case token.PLUS, token.MINUS:
+		return precSum, precProduct
+	case token.MUL, token.DIV:
+		return precProduct, precUnary
+	case token.POWER:
+		return precAtom, precUnary // 右结合，右侧允许一元正负号
+	default: // 比较运算不能连写
+		return precSum, precSum
+	}
+}
+
+// endsWithOpenIf 判断语句是否以没有 ELSE 分支的 IF 结尾
+func endsWithOpenIf(s Statement) bool {
+	switch s := s.(type) {
+	case *IfStatement:
+		if s.Else == nil {
+			return true
+		}
+		return endsWithOpenIf(s.Else)
+	case *ForStatement:
+		return endsWithOpenIf(s.Body)
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package parser
+
+import (
+	"compilers/lexer"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFprint(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"ORIGIN IS (100,2*PI);", "ORIGIN IS (100, 2 * PI);\n"},
+		{"x = -2**2; y = (-2)**2; z = 2**-1**2;", "x = -2 ** 2;\ny = (-2) ** 2;\nz = 2 ** -1 ** 2;\n"},
+		{"x = (1 - 2) - (3 - 4) * (5 / (6 * 7));", "x = 1 - 2 - (3 - 4) * (5 / (6 * 7));\n"},
+		{"x = - -T; y = -(-T);", "x = - -T;\ny = - -T;\n"},
+		{"x = (T < 1) + (NOT (T > 2 OR T < 0));", "x = (T < 1) + (NOT (T > 2 OR T < 0));\n"},
+		{"FUNC f(a,b)=MAX(a,b)  -- 较大值\n", "FUNC f(a, b) = MAX(a, b);\n-- 较大值\n"},
+		{
+			"FOR T FROM 0 TO 1 STEP 0.1 { // 点\nDRAW(T, T); IF T > 0.5 THEN DRAW(T, 0) }",
+			"FOR T FROM 0 TO 1 STEP 0.1 BEGIN\n\t// 点\n\tDRAW (T, T);\n\tIF T > 0.5 THEN DRAW (T, 0);\nEND;\n",
+		},
+		{"IF (T > 0 AND T < 1) OR T == 2 THEN x = 1 ELSE IF T > 3 THEN x = 2;", "IF T > 0 AND T < 1 OR T == 2 THEN x = 1 ELSE IF T > 3 THEN x = 2;\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			statements, diagnostics := New(lexer.New(tt.input)).ParseProgram()
+			if len(diagnostics) > 0 {
+				t.Fatalf("unexpected diagnostics %v", diagnostics)
+			}
+			var sb strings.Builder
+			if err := Fprint(&sb, statements); err != nil {
+				t.Fatal(err)
+			}
+			if got := sb.String(); got != tt.expected {
+				t.Errorf("expected %q, but got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// 格式化后的源代码重新解析应得到相同的语法树
+func TestFprintRoundTrip(t *testing.T) {
+	inputs := []string{
+		"x = 2*3**2**2 - -(1 + T) / (T - 1);",
+		"x = (1 < 2) * (3 >= 4 AND NOT 0 OR 1) ** 2;",
+		"IF T > 0 THEN IF T > 1 THEN x = 1 ELSE x = 2;",
+		"IF T > 0 THEN BEGIN IF T > 1 THEN x = 1; END ELSE x = 2;",
+		"FOR T FROM 0 TO 1 STEP 1 IF T > 0 THEN FOR S FROM 0 TO 1 STEP 1 IF S > 0 THEN DRAW (T, S) ELSE DRAW (S, T);",
+		"FOR T FROM 0 TO 1 STEP 1 IF T > 0 THEN {FOR S FROM 0 TO 1 STEP 1 IF S > 0 THEN DRAW (T, S)} ELSE DRAW (S, T);",
+		"DRAW IS LINES; WIDTH IS 2*(1 + 0.5); JOIN IS MITER; CAP IS BUTT; PUSH; DRAW IS POINTS; POP;",
+		"JOIN IS ROUND; CAP IS ROUND;",
+		`OUTPUT IS "a \"b\".png"; OUTPUT IS "c:\\d.png";`,
+		"PUSH; FOR T FROM 0 TO 1 STEP 1 BEGIN PUSH; ROT IS T; DRAW (T, T); POP; END; POP;",
+		"SHEAR IS (1, -0.5); REFLECT IS PI/4; TRANSFORM IS CUMULATIVE; TRANSFORM IS (1, 0, 0, -1, 0, 600); TRANSFORM IS ABSOLUTE;",
+		"FOR T FROM 0 TO 1 STEP ADAPTIVE DRAW (T, T); FOR T FROM 0 TO 1 STEP ADAPTIVE TOLERANCE 1/4 DRAW (T, T);",
+		"FUNC r(t) = 1 + COS(t); FOR T FROM 0 TO 2*PI STEP PI/50 DRAW (r(T)*COS(T), r(T)*SIN(T));",
+	}
+
+	for _, input := range inputs {
+		t.Run(input, func(t *testing.T) {
+			statements, diagnostics := New(lexer.New(input)).ParseProgram()
+			if len(diagnostics) > 0 {
+				t.Fatalf("unexpected diagnostics %v", diagnostics)
+			}
+			var sb strings.Builder
+			if err := Fprint(&sb, statements); err != nil {
+				t.Fatal(err)
+			}
+			reparsed, diagnostics := New(lexer.New(sb.String())).ParseProgram()
+			if len(diagnostics) > 0 {
+				t.Fatalf("formatted source %q does not parse: %v", sb.String(), diagnostics)
+			}
+			stripSpans(reflect.ValueOf(statements))
+			stripSpans(reflect.ValueOf(reparsed))
+			if !reflect.DeepEqual(statements, reparsed) {
+				t.Errorf("formatted source %q parses to a different tree", sb.String())
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	statements, _ := New(lexer.New("FOR T FROM 0 TO 1 STEP 1 DRAW (T, (T > 0) * 2);")).ParseProgram()
+	draw := statements[0].(*ForStatement).Body.(*DrawStatement)
+	if got, expected := Format(draw), "DRAW (T, (T > 0) * 2)"; got != expected {
+		t.Errorf("expected %q, but got %q", expected, got)
+	}
+	if got, expected := Format(draw.Components[1]), "(T > 0) * 2"; got != expected {
+		t.Errorf("expected %q, but got %q", expected, got)
+	}
+}
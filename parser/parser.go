@@ -4,159 +4,48 @@ import (
 	"compilers/lexer"
 	"compilers/token"
 	"fmt"
-	"math"
+	"slices"
 	"strconv"
+	"strings"
+	"unicode"
 )
 
-// Statement is an interface for all statement types
-type Statement interface {
+// Diagnostic 描述一条带源代码位置的错误信息
+type Diagnostic struct {
+	Pos token.Pos
+	Msg string
 }
 
-// Expression is an interface for all expression types
-type Expression interface {
-	Evaluate(t float64, variables map[string]float64) []float64
+// Error 以 file:line:col: msg 的形式返回诊断信息
+func (d Diagnostic) Error() string {
+	return fmt.Sprintf("%s: %s", d.Pos, d.Msg)
 }
 
-// VariableExpression represents a variable in an expression
-type VariableExpression struct {
-	Name string
-}
+// ErrorList 是一组诊断信息，可以作为 error 返回
+type ErrorList []Diagnostic
 
-func (v *VariableExpression) Evaluate(t float64, variables map[string]float64) []float64 {
-	if val, ok := variables[v.Name]; ok {
-		return []float64{val}
+// Error 返回第一条诊断信息以及其余诊断信息的条数
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
 	}
-	panic(fmt.Sprintf("Undefined variable: %v", v.Name))
-}
-
-// ConstantExpression represents a constant value in an expression
-type ConstantExpression struct {
-	Value string
+	return fmt.Sprintf("%s (and %d more errors)", l[0].Error(), len(l)-1)
 }
 
-func (c *ConstantExpression) Evaluate(t float64, variables map[string]float64) []float64 {
-	if c.Value == "PI" {
-		return []float64{math.Pi}
-	} else if c.Value == "E" {
-		return []float64{math.E}
-	} else if c.Value == "T" {
-		return []float64{t}
-	}
-	val, err := strconv.ParseFloat(c.Value, 64)
-	if err != nil {
-		panic(fmt.Sprintf("Failed to convert constant expression to float: %v", c.Value))
-	}
-	return []float64{val}
-}
-
-// BinaryExpression represents a binary operation in an expression
-type BinaryExpression struct {
-	Left     Expression
-	Right    Expression
-	Operator token.TokenType
-}
-
-func (b *BinaryExpression) Evaluate(t float64, variables map[string]float64) []float64 {
-	left := b.Left.Evaluate(t, variables)[0]
-	right := b.Right.Evaluate(t, variables)[0]
-	var result []float64
-	switch b.Operator {
-	case token.PLUS:
-		result = append(result, left+right)
-	case token.MINUS:
-		result = append(result, left-right)
-	case token.MUL:
-		result = append(result, left*right)
-	case token.DIV:
-		result = append(result, left/right)
-	case token.COMMA:
-		result = append(result, left, right)
-	}
-	return result
-}
-
-// FunctionCallExpression represents a function call in an expression
-type FunctionCallExpression struct {
-	Name      string
-	Arguments []Expression
-}
-
-func (f *FunctionCallExpression) Evaluate(t float64, variables map[string]float64) []float64 {
-	var args []float64
-	for _, arg := range f.Arguments {
-		args = append(args, arg.Evaluate(t, variables)[0])
-	}
-	return applyFunction(f.Name, args)
-}
-
-func applyFunction(name string, args []float64) []float64 {
-	var result []float64
-	switch name {
-	case "SIN":
-		for _, arg := range args {
-			result = append(result, math.Sin(arg))
-		}
-	case "COS":
-		for _, arg := range args {
-			result = append(result, math.Cos(arg))
-		}
-	case "TAN":
-		for _, arg := range args {
-			result = append(result, math.Tan(arg))
-		}
-	case "SQRT":
-		for _, arg := range args {
-			result = append(result, math.Sqrt(arg))
-		}
-	case "EXP":
-		for _, arg := range args {
-			result = append(result, math.Exp(arg))
-		}
-	case "LN":
-		for _, arg := range args {
-			result = append(result, math.Log(arg))
-		}
-	default:
-		panic(fmt.Sprintf("Unknown function: %s", name))
-	}
-	return result
-}
-
-// 语句类型
-type OriginStatement struct {
-	X Expression
-	Y Expression
-}
-
-type ScaleStatement struct {
-	X Expression
-	Y Expression
-}
-
-type RotStatement struct {
-	Angle Expression
-}
-
-type AssignmentStatement struct {
-	Identifier string
-	Value      Expression
-}
-
-type ForStatement struct {
-	LoopVar string
-	Start   Expression
-	End     Expression
-	Step    Expression
-	Body    Statement
-}
-
-type CommentStatement struct {
-}
+// bailout 用于在出错时跳出当前语句的分析
+type bailout struct{}
 
 // Parser 结构体用于解析输入
 type Parser struct {
-	lexer    *lexer.Lexer
-	curToken token.Token
+	lexer       *lexer.Lexer
+	curToken    token.Token
+	prevEnd     token.Pos // 上一个已消费 token 的结束位置
+	loopDepth   int       // 当前所在 FOR 循环体的嵌套层数
+	nesting     int       // 当前所在 FOR / IF / 语句块的嵌套层数
+	diagnostics []Diagnostic
 }
 
 // New 创建一个新的语法分析器
@@ -168,21 +57,74 @@ func New(l *lexer.Lexer) *Parser {
 
 // nextToken 移动到下一个 token
 func (p *Parser) nextToken() {
+	p.prevEnd = p.curToken.End
 	p.curToken = p.lexer.NextToken()
 }
 
-// ParseProgram 解析程序
-func (p *Parser) ParseProgram() []Statement {
+// span 返回从 start 到上一个已消费 token 结尾的范围
+func (p *Parser) span(start token.Pos) Span {
+	return Span{From: start, To: p.prevEnd}
+}
+
+// ParseProgram 解析程序，遇到语法错误时跳到下一条语句继续分析，
+// 返回所有成功解析的语句以及收集到的全部诊断信息
+func (p *Parser) ParseProgram() ([]Statement, []Diagnostic) {
 	var statements []Statement
 	for p.curToken.Type != token.EOF {
-		statements = append(statements, p.parseStatement())
-		if p.curToken.Type == token.SEMICO || p.curToken.Type == token.COMMENT {
+		if stmt := p.parseStatementOrSync(); stmt != nil {
+			statements = append(statements, stmt)
+		}
+	}
+	return statements, p.diagnostics
+}
+
+// parseStatementOrSync 解析一条语句及其结束符；出错时丢弃该语句并重新同步
+func (p *Parser) parseStatementOrSync() (stmt Statement) {
+	start := p.curToken.Start
+	loopDepth, nesting := p.loopDepth, p.nesting
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+			stmt = nil
+			p.loopDepth, p.nesting = loopDepth, nesting
+			p.synchronize(start)
+		}
+	}()
+
+	stmt = p.parseStatement()
+	if _, ok := stmt.(*CommentStatement); ok {
+		return stmt
+	}
+	switch p.curToken.Type {
+	case token.SEMICO:
+		p.nextToken()
+	case token.COMMENT, token.EOF, token.END, token.R_BRACE:
+		// 注释、块结尾和文件结尾同样可以结束一条语句
+	default:
+		p.error(fmt.Sprintf("Expected %s, got %s", token.SEMICO, p.curToken.Type))
+	}
+	return stmt
+}
+
+// synchronize 跳过 token，直到下一个 ";"（会被消费）或语句关键字
+func (p *Parser) synchronize(start token.Pos) {
+	// 保证至少前进一个 token，避免在同一位置反复报错
+	if p.curToken.Start == start && p.curToken.Type != token.EOF {
+		p.nextToken()
+	}
+	for {
+		switch p.curToken.Type {
+		case token.EOF, token.ORIGIN, token.SCALE, token.ROT, token.SHEAR, token.REFLECT, token.TRANSFORM,
+			token.PUSH, token.POP, token.WIDTH, token.JOIN, token.CAP, token.OUTPUT, token.DRAW, token.FOR, token.IF, token.FUNC, token.END, token.R_BRACE:
+			return
+		case token.SEMICO:
 			p.nextToken()
-		} else {
-			break
+			return
 		}
+		p.nextToken()
 	}
-	return statements
 }
 
 // parseStatement 解析一个语句
@@ -194,14 +136,67 @@ func (p *Parser) parseStatement() Statement {
 		return p.parseScaleStatement()
 	case token.ROT:
 		return p.parseRotStatement()
+	case token.SHEAR:
+		return p.parseShearStatement()
+	case token.REFLECT:
+		return p.parseReflectStatement()
+	case token.TRANSFORM:
+		return p.parseTransformStatement()
+	case token.PUSH:
+		start := p.curToken.Start
+		p.nextToken()
+		return &PushStatement{Span: p.span(start)}
+	case token.POP:
+		start := p.curToken.Start
+		p.nextToken()
+		return &PopStatement{Span: p.span(start)}
+	case token.WIDTH:
+		start := p.curToken.Start
+		p.nextToken() // skip WIDTH
+		p.expect(token.IS)
+		width := p.parseExpression()
+		return &WidthStatement{Span: p.span(start), Width: width}
+	case token.JOIN:
+		start := p.curToken.Start
+		p.nextToken() // skip JOIN
+		join := p.parseStyleName(joinMiter, joinRound, joinBevel)
+		return &JoinStatement{Span: p.span(start), Join: join}
+	case token.CAP:
+		start := p.curToken.Start
+		p.nextToken() // skip CAP
+		lineCap := p.parseStyleName(capButt, capRound, capSquare)
+		return &CapStatement{Span: p.span(start), Cap: lineCap}
+	case token.OUTPUT:
+		return p.parseOutputStatement()
 	case token.ID:
 		return p.parseAssignmentStatement()
+	case token.CONST_ID:
+		// 给 PI、E 等命名常量赋值在语法上是合法的，由语义检查报告错误
+		if unicode.IsLetter(rune(p.curToken.Literal[0])) {
+			return p.parseAssignmentStatement()
+		}
+		p.error("Unexpected token in statement: " + p.curToken.Literal)
+		return nil
+	case token.FUNC:
+		if p.nesting > 0 {
+			p.error("FUNC declarations are only allowed at the top level")
+		}
+		return p.parseFunctionDeclaration()
 	case token.FOR:
 		return p.parseForStatement()
-	case token.TAN, token.SIN, token.COS, token.SQRT, token.EXP, token.LN:
-		return p.parseFunctionCall()
+	case token.IF:
+		return p.parseIfStatement()
+	case token.BEGIN, token.L_BRACE:
+		return p.parseBlockStatement()
+	case token.DRAW:
+		return p.parseDrawStatement()
+	case token.BUILTIN:
+		return p.parseExpressionStatement()
 	case token.COMMENT:
 		return p.parseCommentStatement()
+	case token.ILLEGAL:
+		p.error("Illegal character: " + p.curToken.Literal)
+		return nil
 	default:
 		p.error("Unexpected token in statement: " + p.curToken.Literal)
 		return nil
@@ -210,6 +205,7 @@ func (p *Parser) parseStatement() Statement {
 
 // parseOriginStatement 解析 ORIGIN IS 语句
 func (p *Parser) parseOriginStatement() *OriginStatement {
+	start := p.curToken.Start
 	p.nextToken() // skip ORIGIN
 	p.expect(token.IS)
 	p.expect(token.L_BRACKET)
@@ -217,11 +213,12 @@ func (p *Parser) parseOriginStatement() *OriginStatement {
 	p.expect(token.COMMA)
 	y := p.parseExpression()
 	p.expect(token.R_BRACKET)
-	return &OriginStatement{X: x, Y: y}
+	return &OriginStatement{Span: p.span(start), X: x, Y: y}
 }
 
 // parseScaleStatement 解析 SCALE IS 语句
 func (p *Parser) parseScaleStatement() *ScaleStatement {
+	start := p.curToken.Start
 	p.nextToken() // skip SCALE
 	p.expect(token.IS)
 	p.expect(token.L_BRACKET)
@@ -229,80 +226,346 @@ func (p *Parser) parseScaleStatement() *ScaleStatement {
 	p.expect(token.COMMA)
 	y := p.parseExpression()
 	p.expect(token.R_BRACKET)
-	return &ScaleStatement{X: x, Y: y}
+	return &ScaleStatement{Span: p.span(start), X: x, Y: y}
 }
 
 // parseRotStatement 解析 ROT IS 语句
 func (p *Parser) parseRotStatement() *RotStatement {
+	start := p.curToken.Start
 	p.nextToken() // skip ROT
 	p.expect(token.IS)
 	angle := p.parseExpression()
-	return &RotStatement{Angle: angle}
+	return &RotStatement{Span: p.span(start), Angle: angle}
+}
+
+// parseShearStatement 解析 SHEAR IS 语句
+func (p *Parser) parseShearStatement() *ShearStatement {
+	start := p.curToken.Start
+	p.nextToken() // skip SHEAR
+	p.expect(token.IS)
+	p.expect(token.L_BRACKET)
+	x := p.parseExpression()
+	p.expect(token.COMMA)
+	y := p.parseExpression()
+	p.expect(token.R_BRACKET)
+	return &ShearStatement{Span: p.span(start), X: x, Y: y}
+}
+
+// parseReflectStatement 解析 REFLECT IS 语句
+func (p *Parser) parseReflectStatement() *ReflectStatement {
+	start := p.curToken.Start
+	p.nextToken() // skip REFLECT
+	p.expect(token.IS)
+	angle := p.parseExpression()
+	return &ReflectStatement{Span: p.span(start), Angle: angle}
+}
+
+// TRANSFORM IS 之后表示变换方式的词，它们不是保留字
+const (
+	modeCumulative = "CUMULATIVE"
+	modeAbsolute   = "ABSOLUTE"
+)
+
+// parseTransformStatement 解析 TRANSFORM IS (a, b, c, d, e, f) 以及
+// TRANSFORM IS CUMULATIVE / ABSOLUTE
+func (p *Parser) parseTransformStatement() Statement {
+	start := p.curToken.Start
+	p.nextToken() // skip TRANSFORM
+	p.expect(token.IS)
+	if p.isWord() {
+		mode := p.curToken.Literal
+		if mode != modeCumulative && mode != modeAbsolute {
+			p.error(fmt.Sprintf("Expected %s or %s, got %s", modeCumulative, modeAbsolute, mode))
+		}
+		p.nextToken()
+		return &TransformModeStatement{Span: p.span(start), Cumulative: mode == modeCumulative}
+	}
+	components := p.parseExpressionList()
+	return &TransformStatement{Span: p.span(start), Components: components}
+}
+
+// parseOutputStatement 解析 OUTPUT IS "文件名" 语句
+func (p *Parser) parseOutputStatement() *OutputStatement {
+	start := p.curToken.Start
+	p.nextToken() // skip OUTPUT
+	p.expect(token.IS)
+	if p.curToken.Type == token.ILLEGAL && strings.HasPrefix(p.curToken.Literal, `"`) {
+		p.error("Unterminated string literal")
+	}
+	if p.curToken.Type != token.STRING {
+		p.error(fmt.Sprintf("Expected %s, got %s", token.STRING, p.curToken.Type))
+	}
+	path, err := strconv.Unquote(p.curToken.Literal)
+	if err != nil {
+		p.error("Malformed string literal " + p.curToken.Literal)
+	}
+	p.nextToken()
+	return &OutputStatement{Span: p.span(start), Path: path}
 }
 
 // parseForStatement 解析 FOR 语句
 func (p *Parser) parseForStatement() *ForStatement {
+	start := p.curToken.Start
 	p.nextToken() // skip FOR
 
 	loopVar := p.curToken.Literal
-	p.nextToken() // skip loop variable
+	p.expect(token.ID)
 
 	p.expect(token.FROM)
-	start := p.parseExpression()
+	from := p.parseExpression()
 
 	p.expect(token.TO)
 	end := p.parseExpression()
 
 	p.expect(token.STEP)
-	step := p.parseExpression()
+	var step, tolerance Expression
+	adaptive := p.curToken.Type == token.ADAPTIVE
+	if adaptive {
+		p.nextToken()
+		if p.curToken.Type == token.TOLERANCE {
+			p.nextToken()
+			tolerance = p.parseExpression()
+		}
+	} else {
+		step = p.parseExpression()
+	}
 
-	p.expect(token.DRAW)
-	body := p.parseDrawStatement()
+	// 循环体可以是 DRAW 语句、嵌套的 FOR 语句、IF 语句或者语句块
+	p.loopDepth++
+	p.nesting++
+	var body Statement
+	switch p.curToken.Type {
+	case token.FOR:
+		body = p.parseForStatement()
+	case token.IF:
+		body = p.parseIfStatement()
+	case token.BEGIN, token.L_BRACE:
+		body = p.parseBlockStatement()
+	case token.DRAW:
+		body = p.parseDrawStatement()
+	default:
+		// 跳过这个词再恢复，避免把 SCALE 等语句的剩余部分当成下一条语句报告
+		pos, got := p.curToken.Start, p.curToken.Type
+		p.nextToken()
+		p.errorAt(pos, fmt.Sprintf("Expected DRAW/FOR/IF/BEGIN, got %s", got))
+	}
+	p.loopDepth--
+	p.nesting--
 
 	return &ForStatement{
-		LoopVar: loopVar,
-		Start:   start,
-		End:     end,
-		Step:    step,
-		Body:    body,
+		Span:      p.span(start),
+		LoopVar:   loopVar,
+		Start:     from,
+		End:       end,
+		Step:      step,
+		Adaptive:  adaptive,
+		Tolerance: tolerance,
+		Body:      body,
 	}
 }
 
-func (p *Parser) parseDrawStatement() *AssignmentStatement {
-	identifier := "DRAW"
+// parseDrawStatement 解析 DRAW (分量, ...)，分量的个数由语义检查确认
+func (p *Parser) parseDrawStatement() Statement {
+	start := p.curToken.Start
+	p.expect(token.DRAW)
+	if p.curToken.Type == token.IS {
+		mode := p.parseStyleName(drawLines, drawPoints)
+		return &DrawModeStatement{Span: p.span(start), Lines: mode == drawLines}
+	}
+	if p.loopDepth == 0 {
+		p.errorAt(start, "DRAW is only allowed inside a FOR loop body")
+	}
+	components := p.parseExpressionList()
+	return &DrawStatement{Span: p.span(start), Components: components}
+}
+
+// DRAW IS、JOIN IS 和 CAP IS 之后的词，它们不是保留字
+const (
+	drawLines  = "LINES"
+	drawPoints = "POINTS"
+	joinMiter  = "MITER"
+	joinRound  = "ROUND"
+	joinBevel  = "BEVEL"
+	capButt    = "BUTT"
+	capRound   = "ROUND"
+	capSquare  = "SQUARE"
+)
+
+// parseStyleName 解析 IS 以及之后的一个词，这个词必须是 names 之一
+func (p *Parser) parseStyleName(names ...string) string {
+	p.expect(token.IS)
+	name := p.curToken.Literal
+	if !p.isWord() || !slices.Contains(names, name) {
+		p.error(fmt.Sprintf("Expected %s or %s, got %s", strings.Join(names[:len(names)-1], ", "), names[len(names)-1], name))
+	}
+	p.nextToken()
+	return name
+}
+
+// isWord 判断当前 token 是否是一个词。ROUND 等词同时是内置函数名，
+// 嵌入程序也可能登记与 SQUARE、CUMULATIVE 等同名的函数，因此 BUILTIN 同样按字面值比较
+func (p *Parser) isWord() bool {
+	return p.curToken.Type == token.ID || p.curToken.Type == token.BUILTIN
+}
+
+// parseBlockStatement 解析 BEGIN ... END 或 { ... } 语句块
+func (p *Parser) parseBlockStatement() *BlockStatement {
+	start := p.curToken.Start
+	closing := token.END
+	if p.curToken.Type == token.L_BRACE {
+		closing = token.R_BRACE
+	}
+	p.nextToken() // skip BEGIN or {
+
+	p.nesting++
+	var statements []Statement
+	for p.curToken.Type != closing && p.curToken.Type != token.EOF {
+		if stmt := p.parseStatementOrSync(); stmt != nil {
+			statements = append(statements, stmt)
+		}
+		// 出错后可能同步到了不匹配的块结尾
+		if p.curToken.Type == token.END || p.curToken.Type == token.R_BRACE {
+			break
+		}
+	}
+	p.nesting--
+	p.expect(closing)
+	return &BlockStatement{Span: p.span(start), Statements: statements}
+}
+
+// parseIfStatement 解析 IF 条件 THEN 语句 [ELSE 语句]，ELSE 与最近的 IF 匹配
+func (p *Parser) parseIfStatement() *IfStatement {
+	start := p.curToken.Start
+	p.nextToken() // skip IF
+	condition := p.parseCondition()
+	p.expect(token.THEN)
+	p.nesting++
+	then := p.parseStatement()
+	var otherwise Statement
+	if p.curToken.Type == token.ELSE {
+		p.nextToken()
+		otherwise = p.parseStatement()
+	}
+	p.nesting--
+	return &IfStatement{Span: p.span(start), Condition: condition, Then: then, Else: otherwise}
+}
+
+// parseFunctionDeclaration 解析 FUNC 名字(参数, ...) = 表达式
+func (p *Parser) parseFunctionDeclaration() *FunctionDeclaration {
+	start := p.curToken.Start
+	p.nextToken() // skip FUNC
+
+	name := p.curToken.Literal
+	p.expect(token.ID)
 	p.expect(token.L_BRACKET)
-	value1 := p.parseExpression()
-	p.expect(token.COMMA)
-	value2 := p.parseExpression()
-	value := &BinaryExpression{
-		Left:     value1,
-		Operator: token.COMMA,
-		Right:    value2,
+
+	var params []string
+	seen := make(map[string]bool)
+	for p.curToken.Type != token.R_BRACKET {
+		if len(params) > 0 {
+			p.expect(token.COMMA)
+		}
+		param := p.curToken.Literal
+		if seen[param] {
+			p.error("Duplicate parameter " + param + " in function " + name)
+		}
+		p.expect(token.ID)
+		seen[param] = true
+		params = append(params, param)
 	}
 	p.expect(token.R_BRACKET)
-	return &AssignmentStatement{Identifier: identifier, Value: value}
+
+	p.expect(token.ASSIGN)
+	body := p.parseExpression()
+	return &FunctionDeclaration{Span: p.span(start), Name: name, Params: params, Body: body}
 }
 
 func (p *Parser) parseCommentStatement() *CommentStatement {
-	return &CommentStatement{}
+	start := p.curToken.Start
+	text := p.curToken.Literal
+	p.nextToken() // skip comment
+	return &CommentStatement{Span: p.span(start), Text: text}
 }
 
-// parseAssignmentStatement 解析赋值语句
-func (p *Parser) parseAssignmentStatement() *AssignmentStatement {
+// parseAssignmentStatement 解析赋值语句；标识符后紧跟 "(" 时解析为函数调用语句
+func (p *Parser) parseAssignmentStatement() Statement {
+	start := p.curToken.Start
 	identifier := p.curToken.Literal
 	p.nextToken() // skip identifier
 
+	if p.curToken.Type == token.L_BRACKET {
+		call := p.parseCallArguments(start, identifier)
+		return &ExpressionStatement{Span: p.span(start), X: call}
+	}
+
 	// 确保当前 token 是赋值操作符 "="
 	p.expect(token.ASSIGN)
 
 	// 解析右侧的表达式
 	value := p.parseExpression()
 
-	return &AssignmentStatement{Identifier: identifier, Value: value}
+	return &AssignmentStatement{Span: p.span(start), Identifier: identifier, Value: value}
+}
+
+// parseExpressionStatement 解析单独的表达式语句
+func (p *Parser) parseExpressionStatement() *ExpressionStatement {
+	start := p.curToken.Start
+	x := p.parseExpression()
+	return &ExpressionStatement{Span: p.span(start), X: x}
+}
+
+// parseCondition 解析条件表达式 AndCondition {OR AndCondition}
+func (p *Parser) parseCondition() Expression {
+	start := p.curToken.Start
+	left := p.parseAndCondition()
+	for p.curToken.Type == token.OR {
+		p.nextToken()
+		right := p.parseAndCondition()
+		left = &BinaryExpression{Span: p.span(start), Left: left, Operator: token.OR, Right: right}
+	}
+	return left
+}
+
+// parseAndCondition 解析 NotCondition {AND NotCondition}
+func (p *Parser) parseAndCondition() Expression {
+	start := p.curToken.Start
+	left := p.parseNotCondition()
+	for p.curToken.Type == token.AND {
+		p.nextToken()
+		right := p.parseNotCondition()
+		left = &BinaryExpression{Span: p.span(start), Left: left, Operator: token.AND, Right: right}
+	}
+	return left
+}
+
+// parseNotCondition 解析 NOT NotCondition | Comparison
+func (p *Parser) parseNotCondition() Expression {
+	if p.curToken.Type != token.NOT {
+		return p.parseComparison()
+	}
+	start := p.curToken.Start
+	p.nextToken()
+	operand := p.parseNotCondition()
+	return &UnaryExpression{Span: p.span(start), Operator: token.NOT, Operand: operand}
+}
+
+// parseComparison 解析 Expression [比较运算符 Expression]，比较运算不能连写
+func (p *Parser) parseComparison() Expression {
+	start := p.curToken.Start
+	left := p.parseExpression()
+	switch p.curToken.Type {
+	case token.LT, token.LE, token.GT, token.GE, token.EQ, token.NE:
+		operator := p.curToken.Type
+		p.nextToken()
+		right := p.parseExpression()
+		return &BinaryExpression{Span: p.span(start), Left: left, Operator: operator, Right: right}
+	}
+	return left
 }
 
 // parseExpression 解析表达式
 func (p *Parser) parseExpression() Expression {
+	start := p.curToken.Start
 	left := p.parseTerm()
 
 	// Check for operators in the form of Expression PLUS Term | Expression MINUS Term
@@ -311,19 +574,19 @@ func (p *Parser) parseExpression() Expression {
 		p.nextToken()
 		right := p.parseTerm()
 		left = &BinaryExpression{
+			Span:     p.span(start),
 			Left:     left,
 			Operator: operator,
 			Right:    right,
 		}
-		p.nextToken()
 	}
 	return left
 }
 
 // parseTerm 解析乘法和除法
 func (p *Parser) parseTerm() Expression {
+	start := p.curToken.Start
 	left := p.parseFactor()
-	p.nextToken()
 
 	// Check for MUL or DIV operators
 	for p.curToken.Type == token.MUL || p.curToken.Type == token.DIV {
@@ -331,11 +594,11 @@ func (p *Parser) parseTerm() Expression {
 		p.nextToken()
 		right := p.parseFactor()
 		left = &BinaryExpression{
+			Span:     p.span(start),
 			Left:     left,
 			Operator: operator,
 			Right:    right,
 		}
-		p.nextToken()
 	}
 	return left
 }
@@ -344,75 +607,99 @@ func (p *Parser) parseTerm() Expression {
 func (p *Parser) parseFactor() Expression {
 	switch p.curToken.Type {
 	case token.PLUS, token.MINUS:
+		start := p.curToken.Start
 		operator := p.curToken.Type
 		p.nextToken()
-		factor := p.parseComponent()
-		return &BinaryExpression{
-			Left:     &ConstantExpression{"0"}, // 表示 "+Factor" 或 "-Factor"
-			Operator: operator,
-			Right:    factor,
-		}
+		operand := p.parseFactor()
+		return &UnaryExpression{Span: p.span(start), Operator: operator, Operand: operand}
 	default:
 		return p.parseComponent()
 	}
 }
 
-// parseComponent 解析原子表达式（包括函数调用）
+// parseComponent 解析幂运算 Atom [** Factor]，** 为右结合，
+// 且优先级高于一元正负号，因此 -2**2 = -(2**2)
 func (p *Parser) parseComponent() Expression {
+	start := p.curToken.Start
+	left := p.parseAtom()
+	if p.curToken.Type != token.POWER {
+		return left
+	}
+	p.nextToken()
+	right := p.parseFactor() // 递归实现右结合，同时允许 2**-1
+	return &BinaryExpression{
+		Span:     p.span(start),
+		Left:     left,
+		Operator: token.POWER,
+		Right:    right,
+	}
+}
+
+// parseAtom 解析原子表达式（包括函数调用）
+func (p *Parser) parseAtom() Expression {
+	start := p.curToken.Start
 	// 处理数字常量或标识符（变量）
 	switch p.curToken.Type {
 	case token.CONST_ID:
-		return &ConstantExpression{Value: p.curToken.Literal}
+		value := p.curToken.Literal
+		p.nextToken()
+		return &ConstantExpression{Span: p.span(start), Value: value}
 	case token.ID:
-		// 判断当前 ID 是否是已知函数名
-		if isFunction(p.curToken.Literal) {
-			return p.parseFunctionCall()
+		name := p.curToken.Literal
+		p.nextToken()
+		// 标识符后紧跟 "(" 是对用户自定义函数的调用
+		if p.curToken.Type == token.L_BRACKET {
+			return p.parseCallArguments(start, name)
 		}
-		// 处理普通的标识符（变量名）
-		return &ConstantExpression{Value: p.curToken.Literal}
+		// 处理普通的标识符（变量名），其值在求值时才查找
+		return &VariableExpression{Span: p.span(start), Name: name}
 	case token.L_BRACKET:
-		// 解析括号内的表达式
+		// 解析括号内的表达式，括号内允许比较和逻辑运算，结果为 1 或 0
 		p.nextToken()
-		expr := p.parseExpression()
+		expr := p.parseCondition()
 		p.expect(token.R_BRACKET)
 		return expr
-	case token.TAN, token.SIN, token.COS, token.SQRT, token.EXP, token.LN:
+	case token.BUILTIN:
 		return p.parseFunctionCall()
 	default:
-		p.error("Unexpected token in component: " + p.curToken.Literal)
+		p.error("Unexpected token in atom: " + p.curToken.Literal)
 		return nil
 	}
 }
 
-// isFunction 检查给定的标识符是否为已知的函数名
-func isFunction(name string) bool {
-	switch name {
-	case "SIN", "COS", "TAN", "SQRT", "EXP", "LN":
-		return true
-	default:
-		return false
-	}
-}
-
 // parseFunctionCall 解析函数调用表达式
 func (p *Parser) parseFunctionCall() *FunctionCallExpression {
+	start := p.curToken.Start
 	funcName := p.curToken.Literal
 	p.nextToken() // skip function name
+	return p.parseCallArguments(start, funcName)
+}
+
+// parseCallArguments 解析函数名之后的 (参数, ...)
+func (p *Parser) parseCallArguments(start token.Pos, funcName string) *FunctionCallExpression {
+	arguments := p.parseExpressionList()
+	return &FunctionCallExpression{
+		Span:      p.span(start),
+		Name:      funcName,
+		Arguments: arguments,
+	}
+}
+
+// parseExpressionList 解析括号内以逗号分隔的表达式，括号内可以为空
+func (p *Parser) parseExpressionList() []Expression {
 	p.expect(token.L_BRACKET)
 
-	var arguments []Expression
-	for p.curToken.Type != token.R_BRACKET {
-		arguments = append(arguments, p.parseExpression())
-		if p.curToken.Type == token.COMMA {
+	var list []Expression
+	if p.curToken.Type != token.R_BRACKET {
+		list = append(list, p.parseExpression())
+		for p.curToken.Type == token.COMMA {
 			p.nextToken() // skip comma
+			list = append(list, p.parseExpression())
 		}
 	}
 
-	//p.expect(token.R_BRACKET)
-	return &FunctionCallExpression{
-		Name:      funcName,
-		Arguments: arguments,
-	}
+	p.expect(token.R_BRACKET)
+	return list
 }
 
 // expect 检查当前 token 类型是否匹配，如果不匹配则报错
@@ -424,7 +711,16 @@ func (p *Parser) expect(t token.TokenType) {
 	}
 }
 
-// error 报告语法错误
+// error 在当前 token 处记录一条语法错误，并放弃当前语句
 func (p *Parser) error(msg string) {
-	panic(msg)
+	p.errorAt(p.curToken.Start, msg)
+}
+
+// errorAt 在 pos 处记录一条语法错误，并放弃当前语句
+func (p *Parser) errorAt(pos token.Pos, msg string) {
+	// 同一位置只报告第一条错误，避免恢复过程中产生连锁错误
+	if n := len(p.diagnostics); n == 0 || p.diagnostics[n-1].Pos != pos {
+		p.diagnostics = append(p.diagnostics, Diagnostic{Pos: pos, Msg: msg})
+	}
+	panic(bailout{})
 }
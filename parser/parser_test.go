@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"compilers/builtin"
 	"compilers/lexer"
 	"compilers/token"
 	"fmt"
@@ -8,6 +9,29 @@ import (
 	"testing"
 )
 
+// stripSpans clears every Span in the tree so that tests can compare
+// structure without spelling out source positions.
+func stripSpans(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			stripSpans(v.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			stripSpans(v.Index(i))
+		}
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(Span{}) {
+			v.Set(reflect.ValueOf(Span{}))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			stripSpans(v.Field(i))
+		}
+	}
+}
+
 func TestParser(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -18,8 +42,8 @@ func TestParser(t *testing.T) {
 			input: "ORIGIN IS (100, 200);",
 			expected: []Statement{
 				&OriginStatement{
-					X: &ConstantExpression{"100"},
-					Y: &ConstantExpression{"200"},
+					X: &ConstantExpression{Value: "100"},
+					Y: &ConstantExpression{Value: "200"},
 				},
 			},
 		},
@@ -28,8 +52,8 @@ func TestParser(t *testing.T) {
 			input: "SCALE IS (1.5, 2.5);",
 			expected: []Statement{
 				&ScaleStatement{
-					X: &ConstantExpression{"1.5"},
-					Y: &ConstantExpression{"2.5"},
+					X: &ConstantExpression{Value: "1.5"},
+					Y: &ConstantExpression{Value: "2.5"},
 				},
 			},
 		},
@@ -38,17 +62,124 @@ func TestParser(t *testing.T) {
 			input: "ROT IS 45;",
 			expected: []Statement{
 				&RotStatement{
-					Angle: &ConstantExpression{"45"},
+					Angle: &ConstantExpression{Value: "45"},
 				},
 			},
 		},
+		// Test transform statements
+		{
+			input: "SHEAR IS (0.5, 0); REFLECT IS PI/2; TRANSFORM IS (1, 0, 0, 1, x, y); TRANSFORM IS CUMULATIVE; TRANSFORM IS ABSOLUTE;",
+			expected: []Statement{
+				&ShearStatement{
+					X: &ConstantExpression{Value: "0.5"},
+					Y: &ConstantExpression{Value: "0"},
+				},
+				&ReflectStatement{
+					Angle: &BinaryExpression{
+						Left:     &ConstantExpression{Value: "PI"},
+						Operator: token.DIV,
+						Right:    &ConstantExpression{Value: "2"},
+					},
+				},
+				&TransformStatement{
+					Components: []Expression{
+						&ConstantExpression{Value: "1"},
+						&ConstantExpression{Value: "0"},
+						&ConstantExpression{Value: "0"},
+						&ConstantExpression{Value: "1"},
+						&VariableExpression{Name: "x"},
+						&VariableExpression{Name: "y"},
+					},
+				},
+				&TransformModeStatement{Cumulative: true},
+				&TransformModeStatement{Cumulative: false},
+			},
+		},
+		// Test "PUSH" and "POP" statements
+		{
+			input: "PUSH; ROT IS 1; POP;",
+			expected: []Statement{
+				&PushStatement{},
+				&RotStatement{Angle: &ConstantExpression{Value: "1"}},
+				&PopStatement{},
+			},
+		},
+		// Test line style statements
+		{
+			input: "DRAW IS LINES; WIDTH IS 2*w; JOIN IS BEVEL; CAP IS SQUARE; DRAW IS POINTS;",
+			expected: []Statement{
+				&DrawModeStatement{Lines: true},
+				&WidthStatement{Width: &BinaryExpression{
+					Left:     &ConstantExpression{Value: "2"},
+					Operator: token.MUL,
+					Right:    &VariableExpression{Name: "w"},
+				}},
+				&JoinStatement{Join: "BEVEL"},
+				&CapStatement{Cap: "SQUARE"},
+				&DrawModeStatement{Lines: false},
+			},
+		},
+		// ROUND 同时是内置函数名
+		{
+			input: "JOIN IS ROUND; CAP IS ROUND;",
+			expected: []Statement{
+				&JoinStatement{Join: "ROUND"},
+				&CapStatement{Cap: "ROUND"},
+			},
+		},
+		// Test "OUTPUT" statement
+		{
+			input: `OUTPUT IS "curves/\u00e9.png";`,
+			expected: []Statement{
+				&OutputStatement{Path: "curves/é.png"},
+			},
+		},
 		// Test assignment statement
 		{
 			input: "myVar = 100;",
 			expected: []Statement{
 				&AssignmentStatement{
 					Identifier: "myVar",
-					Value:      &ConstantExpression{"100"},
+					Value:      &ConstantExpression{Value: "100"},
+				},
+			},
+		},
+		// Test "**" binds tighter than unary minus
+		{
+			input: "x = -2**2;",
+			expected: []Statement{
+				&AssignmentStatement{
+					Identifier: "x",
+					Value: &UnaryExpression{
+						Operator: token.MINUS,
+						Operand: &BinaryExpression{
+							Left:     &ConstantExpression{Value: "2"},
+							Operator: token.POWER,
+							Right:    &ConstantExpression{Value: "2"},
+						},
+					},
+				},
+			},
+		},
+		// Test "**" is right-associative and binds tighter than "*"
+		{
+			input: "x = 2*3**2**2;",
+			expected: []Statement{
+				&AssignmentStatement{
+					Identifier: "x",
+					Value: &BinaryExpression{
+						Left:     &ConstantExpression{Value: "2"},
+						Operator: token.MUL,
+						Right: &BinaryExpression{
+							Left:     &ConstantExpression{Value: "3"},
+							Operator: token.POWER,
+							Right: &BinaryExpression{
+								Left:     &ConstantExpression{Value: "2"},
+								Operator: token.POWER,
+								Right:    &ConstantExpression{Value: "2"},
+							},
+						},
+					},
 				},
 			},
 		},
@@ -58,33 +189,266 @@ func TestParser(t *testing.T) {
 			expected: []Statement{
 				&ForStatement{
 					LoopVar: "T",
-					Start:   &ConstantExpression{"0"},
-					End:     &ConstantExpression{"120"},
-					Step:    &ConstantExpression{"1"},
-					Body: &AssignmentStatement{
-						Identifier: "DRAW",
-						Value: &BinaryExpression{
-							Left:     &ConstantExpression{"T"},
-							Operator: token.COMMA,
-							Right: &BinaryExpression{
-								Left:     &ConstantExpression{"3"},
+					Start:   &ConstantExpression{Value: "0"},
+					End:     &ConstantExpression{Value: "120"},
+					Step:    &ConstantExpression{Value: "1"},
+					Body: &DrawStatement{
+						Components: []Expression{
+							&VariableExpression{Name: "T"},
+							&BinaryExpression{
+								Left:     &ConstantExpression{Value: "3"},
 								Operator: token.MUL,
-								Right:    &ConstantExpression{"T"},
+								Right:    &VariableExpression{Name: "T"},
 							},
 						},
 					},
 				},
 			},
 		},
-		// Test "Sin" function call
+		// Test "FOR" loop with adaptive sampling
 		{
-			input: "SIN(30);",
+			input: "FOR T FROM 0 TO 1 STEP ADAPTIVE TOLERANCE 0.25 DRAW (T, T);\nFOR T FROM 0 TO 1 STEP ADAPTIVE DRAW (T, T);",
+			expected: []Statement{
+				&ForStatement{
+					LoopVar:   "T",
+					Start:     &ConstantExpression{Value: "0"},
+					End:       &ConstantExpression{Value: "1"},
+					Adaptive:  true,
+					Tolerance: &ConstantExpression{Value: "0.25"},
+					Body: &DrawStatement{
+						Components: []Expression{&VariableExpression{Name: "T"}, &VariableExpression{Name: "T"}},
+					},
+				},
+				&ForStatement{
+					LoopVar:  "T",
+					Start:    &ConstantExpression{Value: "0"},
+					End:      &ConstantExpression{Value: "1"},
+					Adaptive: true,
+					Body: &DrawStatement{
+						Components: []Expression{&VariableExpression{Name: "T"}, &VariableExpression{Name: "T"}},
+					},
+				},
+			},
+		},
+		// Test nested "FOR" loop statement
+		{
+			input: "FOR a FROM 1 TO 5 STEP 1 FOR T FROM 0 TO a STEP 1 DRAW (a, T);",
+			expected: []Statement{
+				&ForStatement{
+					LoopVar: "a",
+					Start:   &ConstantExpression{Value: "1"},
+					End:     &ConstantExpression{Value: "5"},
+					Step:    &ConstantExpression{Value: "1"},
+					Body: &ForStatement{
+						LoopVar: "T",
+						Start:   &ConstantExpression{Value: "0"},
+						End:     &VariableExpression{Name: "a"},
+						Step:    &ConstantExpression{Value: "1"},
+						Body: &DrawStatement{
+							Components: []Expression{
+								&VariableExpression{Name: "a"},
+								&VariableExpression{Name: "T"},
+							},
+						},
+					},
+				},
+			},
+		},
+		// Test "FOR" loop with a BEGIN ... END block body
+		{
+			input: "FOR T FROM 0 TO 1 STEP 1 BEGIN x = 2*T; DRAW (x, T); ROT IS T END;",
+			expected: []Statement{
+				&ForStatement{
+					LoopVar: "T",
+					Start:   &ConstantExpression{Value: "0"},
+					End:     &ConstantExpression{Value: "1"},
+					Step:    &ConstantExpression{Value: "1"},
+					Body: &BlockStatement{
+						Statements: []Statement{
+							&AssignmentStatement{
+								Identifier: "x",
+								Value: &BinaryExpression{
+									Left:     &ConstantExpression{Value: "2"},
+									Operator: token.MUL,
+									Right:    &VariableExpression{Name: "T"},
+								},
+							},
+							&DrawStatement{
+								Components: []Expression{
+									&VariableExpression{Name: "x"},
+									&VariableExpression{Name: "T"},
+								},
+							},
+							&RotStatement{
+								Angle: &VariableExpression{Name: "T"},
+							},
+						},
+					},
+				},
+			},
+		},
+		// Test "FOR" loop with a { ... } block body containing a nested loop
+		{
+			input: "FOR a FROM 0 TO 1 STEP 1 { // outer\n DRAW (a, a); FOR b FROM 0 TO 1 STEP 1 DRAW (a, b); };",
+			expected: []Statement{
+				&ForStatement{
+					LoopVar: "a",
+					Start:   &ConstantExpression{Value: "0"},
+					End:     &ConstantExpression{Value: "1"},
+					Step:    &ConstantExpression{Value: "1"},
+					Body: &BlockStatement{
+						Statements: []Statement{
+							&CommentStatement{Text: "// outer"},
+							&DrawStatement{
+								Components: []Expression{
+									&VariableExpression{Name: "a"},
+									&VariableExpression{Name: "a"},
+								},
+							},
+							&ForStatement{
+								LoopVar: "b",
+								Start:   &ConstantExpression{Value: "0"},
+								End:     &ConstantExpression{Value: "1"},
+								Step:    &ConstantExpression{Value: "1"},
+								Body: &DrawStatement{
+									Components: []Expression{
+										&VariableExpression{Name: "a"},
+										&VariableExpression{Name: "b"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		// Test "IF ... THEN ... ELSE" with comparison and logical operators
+		{
+			input: "IF x < 1 AND NOT y >= 2 OR z == 3 THEN x = 1 ELSE BEGIN y = 2 END;",
+			expected: []Statement{
+				&IfStatement{
+					Condition: &BinaryExpression{
+						Left: &BinaryExpression{
+							Left: &BinaryExpression{
+								Left:     &VariableExpression{Name: "x"},
+								Operator: token.LT,
+								Right:    &ConstantExpression{Value: "1"},
+							},
+							Operator: token.AND,
+							Right: &UnaryExpression{
+								Operator: token.NOT,
+								Operand: &BinaryExpression{
+									Left:     &VariableExpression{Name: "y"},
+									Operator: token.GE,
+									Right:    &ConstantExpression{Value: "2"},
+								},
+							},
+						},
+						Operator: token.OR,
+						Right: &BinaryExpression{
+							Left:     &VariableExpression{Name: "z"},
+							Operator: token.EQ,
+							Right:    &ConstantExpression{Value: "3"},
+						},
+					},
+					Then: &AssignmentStatement{
+						Identifier: "x",
+						Value:      &ConstantExpression{Value: "1"},
+					},
+					Else: &BlockStatement{
+						Statements: []Statement{
+							&AssignmentStatement{
+								Identifier: "y",
+								Value:      &ConstantExpression{Value: "2"},
+							},
+						},
+					},
+				},
+			},
+		},
+		// Test "IF" inside a "FOR" body, ELSE binds to the nearest IF
+		{
+			input: "FOR T FROM 0 TO 1 STEP 1 IF T > 0 THEN IF T < 1 THEN DRAW (T, 0) ELSE DRAW (T, 1);",
 			expected: []Statement{
+				&ForStatement{
+					LoopVar: "T",
+					Start:   &ConstantExpression{Value: "0"},
+					End:     &ConstantExpression{Value: "1"},
+					Step:    &ConstantExpression{Value: "1"},
+					Body: &IfStatement{
+						Condition: &BinaryExpression{
+							Left:     &VariableExpression{Name: "T"},
+							Operator: token.GT,
+							Right:    &ConstantExpression{Value: "0"},
+						},
+						Then: &IfStatement{
+							Condition: &BinaryExpression{
+								Left:     &VariableExpression{Name: "T"},
+								Operator: token.LT,
+								Right:    &ConstantExpression{Value: "1"},
+							},
+							Then: &DrawStatement{
+								Components: []Expression{
+									&VariableExpression{Name: "T"},
+									&ConstantExpression{Value: "0"},
+								},
+							},
+							Else: &DrawStatement{
+								Components: []Expression{
+									&VariableExpression{Name: "T"},
+									&ConstantExpression{Value: "1"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		// Test user-defined function declaration and calls
+		{
+			input: "FUNC r(t, k) = 2 + COS(k*t); x = r(1, 5); r(0, 1);",
+			expected: []Statement{
+				&FunctionDeclaration{
+					Name:   "r",
+					Params: []string{"t", "k"},
+					Body: &BinaryExpression{
+						Left:     &ConstantExpression{Value: "2"},
+						Operator: token.PLUS,
+						Right: &FunctionCallExpression{
+							Name: "COS",
+							Arguments: []Expression{
+								&BinaryExpression{
+									Left:     &VariableExpression{Name: "k"},
+									Operator: token.MUL,
+									Right:    &VariableExpression{Name: "t"},
+								},
+							},
+						},
+					},
+				},
 				&AssignmentStatement{
-					Identifier: "Sin",
+					Identifier: "x",
 					Value: &FunctionCallExpression{
-						Name:      "Sin",
-						Arguments: []Expression{&ConstantExpression{"30"}},
+						Name:      "r",
+						Arguments: []Expression{&ConstantExpression{Value: "1"}, &ConstantExpression{Value: "5"}},
+					},
+				},
+				&ExpressionStatement{
+					X: &FunctionCallExpression{
+						Name:      "r",
+						Arguments: []Expression{&ConstantExpression{Value: "0"}, &ConstantExpression{Value: "1"}},
+					},
+				},
+			},
+		},
+		// Test "Sin" function call
+		{
+			input: "SIN(30);",
+			expected: []Statement{
+				&ExpressionStatement{
+					X: &FunctionCallExpression{
+						Name:      "SIN",
+						Arguments: []Expression{&ConstantExpression{Value: "30"}},
 					},
 				},
 			},
@@ -93,11 +457,10 @@ func TestParser(t *testing.T) {
 		{
 			input: "COS(45);",
 			expected: []Statement{
-				&AssignmentStatement{
-					Identifier: "Cos",
-					Value: &FunctionCallExpression{
-						Name:      "Cos",
-						Arguments: []Expression{&ConstantExpression{"45"}},
+				&ExpressionStatement{
+					X: &FunctionCallExpression{
+						Name:      "COS",
+						Arguments: []Expression{&ConstantExpression{Value: "45"}},
 					},
 				},
 			},
@@ -106,11 +469,10 @@ func TestParser(t *testing.T) {
 		{
 			input: "TAN(60);",
 			expected: []Statement{
-				&AssignmentStatement{
-					Identifier: "Tan",
-					Value: &FunctionCallExpression{
-						Name:      "Tan",
-						Arguments: []Expression{&ConstantExpression{"60"}},
+				&ExpressionStatement{
+					X: &FunctionCallExpression{
+						Name:      "TAN",
+						Arguments: []Expression{&ConstantExpression{Value: "60"}},
 					},
 				},
 			},
@@ -119,11 +481,10 @@ func TestParser(t *testing.T) {
 		{
 			input: "SQRT(9);",
 			expected: []Statement{
-				&AssignmentStatement{
-					Identifier: "Sqrt",
-					Value: &FunctionCallExpression{
-						Name:      "Sqrt",
-						Arguments: []Expression{&ConstantExpression{"9"}},
+				&ExpressionStatement{
+					X: &FunctionCallExpression{
+						Name:      "SQRT",
+						Arguments: []Expression{&ConstantExpression{Value: "9"}},
 					},
 				},
 			},
@@ -132,11 +493,10 @@ func TestParser(t *testing.T) {
 		{
 			input: "EXP(1);",
 			expected: []Statement{
-				&AssignmentStatement{
-					Identifier: "Exp",
-					Value: &FunctionCallExpression{
-						Name:      "Exp",
-						Arguments: []Expression{&ConstantExpression{"1"}},
+				&ExpressionStatement{
+					X: &FunctionCallExpression{
+						Name:      "EXP",
+						Arguments: []Expression{&ConstantExpression{Value: "1"}},
 					},
 				},
 			},
@@ -144,12 +504,30 @@ func TestParser(t *testing.T) {
 		// Test "Ln" function call
 		{
 			input: "LN(2);",
+			expected: []Statement{
+				&ExpressionStatement{
+					X: &FunctionCallExpression{
+						Name:      "LN",
+						Arguments: []Expression{&ConstantExpression{Value: "2"}},
+					},
+				},
+			},
+		},
+		// 给命名常量赋值和分量个数不对的 DRAW 在语法上合法，由语义检查报告
+		{
+			input: "PI = 3; FOR T FROM 0 TO 1 STEP 1 DRAW (T);",
 			expected: []Statement{
 				&AssignmentStatement{
-					Identifier: "Ln",
-					Value: &FunctionCallExpression{
-						Name:      "Ln",
-						Arguments: []Expression{&ConstantExpression{"2"}},
+					Identifier: "PI",
+					Value:      &ConstantExpression{Value: "3"},
+				},
+				&ForStatement{
+					LoopVar: "T",
+					Start:   &ConstantExpression{Value: "0"},
+					End:     &ConstantExpression{Value: "1"},
+					Step:    &ConstantExpression{Value: "1"},
+					Body: &DrawStatement{
+						Components: []Expression{&VariableExpression{Name: "T"}},
 					},
 				},
 			},
@@ -164,7 +542,11 @@ func TestParser(t *testing.T) {
 			parser := New(l)
 
 			// Parse the program and get the resulting statements
-			statements := parser.ParseProgram()
+			statements, diagnostics := parser.ParseProgram()
+			if len(diagnostics) > 0 {
+				t.Fatalf("For input %s, unexpected diagnostics %v", tt.input, diagnostics)
+			}
+			stripSpans(reflect.ValueOf(statements))
 
 			// Check if the parsed statements match the expected output
 			if !reflect.DeepEqual(statements, tt.expected) {
@@ -175,3 +557,157 @@ func TestParser(t *testing.T) {
 		})
 	}
 }
+
+// 嵌入程序登记的函数与 TRANSFORM IS、CAP IS 之后的词同名时，这些词仍然可以使用
+func TestStyleNamesRegisteredAsFunctions(t *testing.T) {
+	builtin.Register("CUMULATIVE", func(x float64) float64 { return x })
+	builtin.Register("SQUARE", func(x float64) float64 { return x * x })
+
+	statements, diagnostics := New(lexer.New("TRANSFORM IS CUMULATIVE; CAP IS SQUARE; x = SQUARE(2);")).ParseProgram()
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	if _, ok := statements[0].(*TransformModeStatement); !ok {
+		t.Errorf("expected a TransformModeStatement, but got %#v", statements[0])
+	}
+	if _, ok := statements[1].(*CapStatement); !ok {
+		t.Errorf("expected a CapStatement, but got %#v", statements[1])
+	}
+}
+
+func TestParserSpans(t *testing.T) {
+	input := "ORIGIN IS (1, 2);\nFOR T FROM 0 TO 1 STEP 0.5 DRAW (T, SIN(T));"
+	statements, _ := New(lexer.NewFile("a.mygo", input)).ParseProgram()
+	if len(statements) != 2 {
+		t.Fatalf("expected 2 statements, but got %d", len(statements))
+	}
+
+	tests := []struct {
+		node  Node
+		start string
+		end   string
+	}{
+		{statements[0], "a.mygo:1:1", "a.mygo:1:17"},
+		{statements[0].(*OriginStatement).Y, "a.mygo:1:15", "a.mygo:1:16"},
+		{statements[1], "a.mygo:2:1", "a.mygo:2:44"},
+		{statements[1].(*ForStatement).Step, "a.mygo:2:24", "a.mygo:2:27"},
+		{statements[1].(*ForStatement).Body.(*DrawStatement).Components[1], "a.mygo:2:37", "a.mygo:2:43"},
+	}
+	for _, tt := range tests {
+		if got := tt.node.Pos().String(); got != tt.start {
+			t.Errorf("%T: expected start %s, but got %s", tt.node, tt.start, got)
+		}
+		if got := tt.node.EndPos().String(); got != tt.end {
+			t.Errorf("%T: expected end %s, but got %s", tt.node, tt.end, got)
+		}
+	}
+}
+
+func TestParserDiagnostics(t *testing.T) {
+	tests := []struct {
+		input       string
+		statements  int
+		diagnostics []string
+	}{
+		{
+			input:       "ROT IS 0;\nORIGIN (1, 2);",
+			statements:  1,
+			diagnostics: []string{"a.mygo:2:8: Expected IS, got ("},
+		},
+		{
+			// 每条出错的语句都应该被报告，正确的语句仍然保留
+			input:      "ORIGIN IS (1 2);\nSCALE IS (1, 1);\nROT IS ;\nFOR T FROM 0 TO 1 STEP 1 DRAW (T, T);",
+			statements: 2,
+			diagnostics: []string{
+				"a.mygo:1:14: Expected ,, got CONST_ID",
+				"a.mygo:3:8: Unexpected token in atom: ;",
+			},
+		},
+		{
+			// 缺少分号时在下一个语句关键字处恢复
+			input:      "ROT IS 0 SCALE IS (1, 1) ORIGIN IS (0, 0);",
+			statements: 1,
+			diagnostics: []string{
+				"a.mygo:1:10: Expected ;, got SCALE",
+				"a.mygo:1:26: Expected ;, got ORIGIN",
+			},
+		},
+		{
+			// 块内的错误在块内恢复，块结尾不匹配同样报告
+			input:      "DRAW (1, 2);\nFOR T FROM 0 TO 1 STEP 1 BEGIN ROT IS ; DRAW (T, T) };\nROT IS 1;",
+			statements: 1,
+			diagnostics: []string{
+				"a.mygo:1:1: DRAW is only allowed inside a FOR loop body",
+				"a.mygo:2:39: Unexpected token in atom: ;",
+				"a.mygo:2:53: Expected END, got }",
+			},
+		},
+		{
+			input:      "FUNC f(t, t) = t;\nFOR T FROM 0 TO 1 STEP 1 BEGIN FUNC g() = 1; DRAW (T, T) END;\nFUNC h() = 1;",
+			statements: 2,
+			diagnostics: []string{
+				"a.mygo:1:11: Duplicate parameter t in function f",
+				"a.mygo:2:32: FUNC declarations are only allowed at the top level",
+			},
+		},
+		{
+			input:      "x = 1 $ 2;\n@;\nROT IS 1;",
+			statements: 1,
+			diagnostics: []string{
+				"a.mygo:1:7: Expected ;, got ILLEGAL",
+				"a.mygo:2:1: Illegal character: @",
+			},
+		},
+		{
+			input:      "TRANSFORM IS RELATIVE;\nSHEAR IS 1;\nREFLECT IS 0;",
+			statements: 1,
+			diagnostics: []string{
+				"a.mygo:1:14: Expected CUMULATIVE or ABSOLUTE, got RELATIVE",
+				"a.mygo:2:10: Expected (, got CONST_ID",
+			},
+		},
+		{
+			input:      "DRAW IS DOTS;\nJOIN IS SHARP;\nCAP IS;\nDRAW (1, 2);\nWIDTH IS 2;",
+			statements: 1,
+			diagnostics: []string{
+				"a.mygo:1:9: Expected LINES or POINTS, got DOTS",
+				"a.mygo:2:9: Expected MITER, ROUND or BEVEL, got SHARP",
+				"a.mygo:3:7: Expected BUTT, ROUND or SQUARE, got ;",
+				"a.mygo:4:1: DRAW is only allowed inside a FOR loop body",
+			},
+		},
+		{
+			input:      "OUTPUT IS out.png;\nOUTPUT IS \"out.png\nROT IS 1;",
+			statements: 1,
+			diagnostics: []string{
+				"a.mygo:1:11: Expected STRING, got ID",
+				"a.mygo:2:11: Unterminated string literal",
+			},
+		},
+		{
+			// FOR 的循环体只能是 DRAW、FOR、IF 或语句块
+			input:      "FOR T FROM 0 TO 1 STEP 0.5 SCALE (T, T);\nFOR T FROM 0 TO 1 STEP 1 OUTPUT IS \"x.gif\";\nROT IS 1;",
+			statements: 1,
+			diagnostics: []string{
+				"a.mygo:1:28: Expected DRAW/FOR/IF/BEGIN, got SCALE",
+				"a.mygo:2:26: Expected DRAW/FOR/IF/BEGIN, got OUTPUT",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			statements, diagnostics := New(lexer.NewFile("a.mygo", tt.input)).ParseProgram()
+			if len(statements) != tt.statements {
+				t.Errorf("expected %d statements, but got %d", tt.statements, len(statements))
+			}
+			var got []string
+			for _, d := range diagnostics {
+				got = append(got, d.Error())
+			}
+			if !reflect.DeepEqual(got, tt.diagnostics) {
+				t.Errorf("expected diagnostics %q, but got %q", tt.diagnostics, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package parser
+
+import "fmt"
+
+// Visitor 的 Visit 方法对 Walk 遇到的每个节点调用一次。
+// 如果返回的 w 不为 nil，Walk 用 w 访问该节点的每个子节点，最后调用 w.Visit(nil)
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk 以深度优先的顺序遍历语法树：先调用 v.Visit(node)，
+// 再按源代码中的顺序遍历子节点。node 不能为 nil
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	// 表达式
+	case *VariableExpression, *ConstantExpression:
+		// 没有子节点
+	case *BinaryExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+	case *UnaryExpression:
+		Walk(v, n.Operand)
+	case *FunctionCallExpression:
+		for _, arg := range n.Arguments {
+			Walk(v, arg)
+		}
+
+	// 语句
+	case *OriginStatement:
+		Walk(v, n.X)
+		Walk(v, n.Y)
+	case *ScaleStatement:
+		Walk(v, n.X)
+		Walk(v, n.Y)
+	case *RotStatement:
+		Walk(v, n.Angle)
+	case *ShearStatement:
+		Walk(v, n.X)
+		Walk(v, n.Y)
+	case *ReflectStatement:
+		Walk(v, n.Angle)
+	case *TransformStatement:
+		for _, c := range n.Components {
+			Walk(v, c)
+		}
+	case *WidthStatement:
+		Walk(v, n.Width)
+	case *TransformModeStatement, *PushStatement, *PopStatement, *OutputStatement,
+		*DrawModeStatement, *JoinStatement, *CapStatement:
+		// 没有子节点
+	case *AssignmentStatement:
+		Walk(v, n.Value)
+	case *DrawStatement:
+		for _, c := range n.Components {
+			Walk(v, c)
+		}
+	case *BlockStatement:
+		WalkList(v, n.Statements)
+	case *IfStatement:
+		Walk(v, n.Condition)
+		Walk(v, n.Then)
+		if n.Else != nil {
+			Walk(v, n.Else)
+		}
+	case *FunctionDeclaration:
+		Walk(v, n.Body)
+	case *ExpressionStatement:
+		Walk(v, n.X)
+	case *ForStatement:
+		Walk(v, n.Start)
+		Walk(v, n.End)
+		if n.Step != nil {
+			Walk(v, n.Step)
+		}
+		if n.Tolerance != nil {
+			Walk(v, n.Tolerance)
+		}
+		Walk(v, n.Body)
+	case *CommentStatement:
+		// 没有子节点
+
+	default:
+		panic(fmt.Sprintf("parser.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+// WalkList 依次遍历一组语句，例如 ParseProgram 返回的整个程序
+func WalkList(v Visitor, statements []Statement) {
+	for _, stmt := range statements {
+		Walk(v, stmt)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect 以深度优先的顺序遍历语法树，对每个节点调用 f(node)；
+// f 返回 false 时不再访问该节点的子节点。每个节点的子节点访问完之后调用 f(nil)
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
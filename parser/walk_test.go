@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"compilers/lexer"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	input := "x = 1 + -T;\nFOR T FROM 0 TO 1 STEP 0.5 IF NOT T > 0 THEN DRAW (T, SIN(T)) ELSE DRAW (0, 0);"
+	statements, diagnostics := New(lexer.New(input)).ParseProgram()
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+
+	var got []string
+	for _, stmt := range statements {
+		Inspect(stmt, func(n Node) bool {
+			if n != nil {
+				got = append(got, fmt.Sprintf("%T", n)[len("*parser."):])
+			}
+			return true
+		})
+	}
+
+	expected := []string{
+		"AssignmentStatement", "BinaryExpression", "ConstantExpression", "UnaryExpression", "VariableExpression",
+		"ForStatement", "ConstantExpression", "ConstantExpression", "ConstantExpression",
+		"IfStatement", "UnaryExpression", "BinaryExpression", "VariableExpression", "ConstantExpression",
+		"DrawStatement", "VariableExpression", "FunctionCallExpression", "VariableExpression",
+		"DrawStatement", "ConstantExpression", "ConstantExpression",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, but got %v", expected, got)
+	}
+}
+
+func TestInspectPrune(t *testing.T) {
+	input := "FUNC f(a) = a * SIN(a);\nFOR T FROM 0 TO 1 STEP 0.5 DRAW (T, f(T));"
+	statements, _ := New(lexer.New(input)).ParseProgram()
+
+	// 不进入函数体，只收集循环中的函数调用
+	var calls []string
+	for _, stmt := range statements {
+		Inspect(stmt, func(n Node) bool {
+			switch n := n.(type) {
+			case *FunctionDeclaration:
+				return false
+			case *FunctionCallExpression:
+				calls = append(calls, n.Name)
+			}
+			return true
+		})
+	}
+	if expected := []string{"f"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected %v, but got %v", expected, calls)
+	}
+}
+
+// depthVisitor 记录遍历过程中到达的最大嵌套深度
+type depthVisitor struct {
+	depth int
+	max   *int
+}
+
+func (v depthVisitor) Visit(n Node) Visitor {
+	if n == nil {
+		return nil
+	}
+	if v.depth > *v.max {
+		*v.max = v.depth
+	}
+	return depthVisitor{depth: v.depth + 1, max: v.max}
+}
+
+func TestWalk(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"x = 1;", 1},
+		{"x = 1 + 2 * 3;", 3},
+		{"BEGIN x = 1; y = 2; END;", 2},
+		{"FOR T FROM 0 TO 1 STEP 1 FOR S FROM 0 TO 1 STEP 1 DRAW (T, -S);", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			statements, diagnostics := New(lexer.New(tt.input)).ParseProgram()
+			if len(diagnostics) > 0 {
+				t.Fatalf("unexpected diagnostics %v", diagnostics)
+			}
+			max := 0
+			WalkList(depthVisitor{max: &max}, statements)
+			if max != tt.expected {
+				t.Errorf("expected depth %d, but got %d", tt.expected, max)
+			}
+		})
+	}
+}
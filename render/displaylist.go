@@ -0,0 +1,252 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"gonum.org/v1/plot/vg/vgimg"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"strconv"
+)
+
+// Point 是一个二维坐标，JSON 中写作 [x, y]
+type Point struct {
+	X, Y float64
+}
+
+func (p Point) MarshalJSON() ([]byte, error) {
+	return json.Marshal([2]float64{p.X, p.Y})
+}
+
+func (p *Point) UnmarshalJSON(data []byte) error {
+	var xy []float64
+	if err := json.Unmarshal(data, &xy); err != nil || len(xy) != 2 {
+		return fmt.Errorf("Malformed point %s, expected [x, y]", data)
+	}
+	p.X, p.Y = xy[0], xy[1]
+	return nil
+}
+
+// Color 是不透明的 RGB 颜色，JSON 中写作 "#rrggbb"
+type Color struct {
+	R, G, B uint8
+}
+
+// RGBA 实现 color.Color
+func (c Color) RGBA() (r, g, b, a uint32) {
+	return color.NRGBA{R: c.R, G: c.G, B: c.B, A: 0xff}.RGBA()
+}
+
+func (c Color) String() string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func (c Color) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
+func (c *Color) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := strconv.ParseUint(s[min(1, len(s)):], 16, 32)
+	if len(s) != 7 || s[0] != '#' || err != nil {
+		return fmt.Errorf("Malformed color %q, expected #rrggbb", s)
+	}
+	c.R, c.G, c.B = uint8(v>>16), uint8(v>>8), uint8(v)
+	return nil
+}
+
+// Style 是之后的绘图操作使用的样式
+type Style struct {
+	Color Color   `json:"color"` // 点、线和文字的颜色
+	Width float64 `json:"width"` // 线宽，单位为像素
+	Join  Join    `json:"join"`  // 折线拐角的样式
+	Cap   Cap     `json:"cap"`   // 折线端点的样式
+}
+
+// DefaultStyle 是显示列表开始时的样式：黑色，线宽 1 像素，圆角，圆头端点
+var DefaultStyle = Style{Width: 1, Join: JoinRound, Cap: CapRound}
+
+// Join 是折线拐角的样式
+type Join string
+
+const (
+	JoinMiter Join = "miter" // 尖角，过尖时改用斜角
+	JoinRound Join = "round" // 圆角
+	JoinBevel Join = "bevel" // 斜角
+)
+
+// Cap 是折线端点的样式
+type Cap string
+
+const (
+	CapButt   Cap = "butt"   // 平头，在端点处截止
+	CapRound  Cap = "round"  // 圆头
+	CapSquare Cap = "square" // 方头，超出端点半个线宽
+)
+
+// Op 是显示列表中的一个绘图操作。World 是程序中的用户坐标，Device 是坐标变换之后的设备坐标，
+// 重放时只使用设备坐标
+type Op interface {
+	// Kind 返回操作的类型，即 JSON 中 "op" 字段的值
+	Kind() string
+}
+
+// PointOp 画一个实心圆点
+type PointOp struct {
+	World  Point   `json:"world"`
+	Device Point   `json:"device"`
+	Radius float64 `json:"radius"` // 半径，单位为像素
+}
+
+// PolylineOp 按当前样式画一条折线
+type PolylineOp struct {
+	World  []Point `json:"world"`
+	Device []Point `json:"device"`
+}
+
+// StyleOp 改变之后的绘图操作使用的样式
+type StyleOp struct {
+	Style
+}
+
+// LabelOp 以 Device 为左下角写一行文字
+type LabelOp struct {
+	World  Point   `json:"world"`
+	Device Point   `json:"device"`
+	Text   string  `json:"text"`
+	Size   float64 `json:"size"` // 字号，单位为像素
+}
+
+func (*PointOp) Kind() string    { return "point" }
+func (*PolylineOp) Kind() string { return "polyline" }
+func (*StyleOp) Kind() string    { return "style" }
+func (*LabelOp) Kind() string    { return "label" }
+
+// DisplayList 是一次执行画出的全部内容，按顺序记录绘图操作。
+// 显示列表可以保存为 JSON lines 文件，之后不必重新执行程序就能去重、裁剪，
+// 或者以其他格式、其他分辨率重新输出
+type DisplayList struct {
+	Width  int // 画布宽度，单位为像素
+	Height int // 画布高度，单位为像素
+	Ops    []Op
+}
+
+// NewDisplayList 创建一个 width x height 像素的空显示列表
+func NewDisplayList(width, height int) *DisplayList {
+	return &DisplayList{Width: width, Height: height}
+}
+
+// Add 在显示列表末尾追加一个绘图操作
+func (l *DisplayList) Add(op Op) {
+	l.Ops = append(l.Ops, op)
+}
+
+// Replay 按设备坐标把绘图操作依次画到 c 上
+func (l *DisplayList) Replay(c Canvas) {
+	for _, op := range l.Ops {
+		switch op := op.(type) {
+		case *PointOp:
+			c.Point(op.Device.X, op.Device.Y, op.Radius)
+		case *PolylineOp:
+			c.Polyline(op.Device)
+		case *StyleOp:
+			c.SetStyle(op.Style)
+		case *LabelOp:
+			c.Label(op.Device.X, op.Device.Y, op.Text, op.Size)
+		}
+	}
+}
+
+// Scale 返回把画布和设备坐标放大 k 倍之后的显示列表，用于以其他分辨率重新输出，
+// 半径、线宽和字号随之放大，用户坐标保持不变
+func (l *DisplayList) Scale(k float64) *DisplayList {
+	scale := func(p Point) Point { return Point{p.X * k, p.Y * k} }
+	scaled := NewDisplayList(int(float64(l.Width)*k+0.5), int(float64(l.Height)*k+0.5))
+	for _, op := range l.Ops {
+		switch op := op.(type) {
+		case *PointOp:
+			scaled.Add(&PointOp{World: op.World, Device: scale(op.Device), Radius: op.Radius * k})
+		case *PolylineOp:
+			device := make([]Point, len(op.Device))
+			for n, p := range op.Device {
+				device[n] = scale(p)
+			}
+			scaled.Add(&PolylineOp{World: op.World, Device: device})
+		case *StyleOp:
+			style := op.Style
+			style.Width *= k
+			scaled.Add(&StyleOp{Style: style})
+		case *LabelOp:
+			scaled.Add(&LabelOp{World: op.World, Device: scale(op.Device), Text: op.Text, Size: op.Size * k})
+		}
+	}
+	return scaled
+}
+
+// Write 把显示列表按 format 格式写入 w。JSONL 格式写出显示列表本身，
+// 其他格式把显示列表画成以 background 为背景的图像，见 NewWithBackground
+func (l *DisplayList) Write(w io.Writer, format Format, background color.Color) error {
+	if format == JSONL {
+		return l.Encode(w)
+	}
+	r, err := NewWithBackground(format, l.Width, l.Height, background)
+	if err != nil {
+		return err
+	}
+	l.Replay(r)
+	_, err = r.WriteTo(w)
+	return err
+}
+
+// Image 把显示列表画成以 background 为背景的栅格图像，一个设备坐标单位是一个像素
+func (l *DisplayList) Image(background color.Color) image.Image {
+	c := newImageCanvas(l.Width, l.Height)
+	l.Replay(newVGRenderer(vgimg.PngCanvas{Canvas: c}, l.Width, l.Height, background))
+	return c.Image()
+}
+
+// WriteFile 把显示列表按 format 格式写入文件 path，图像为白色背景。JSONL 格式保存显示列表本身，
+// 其他格式把显示列表画成图像
+func (l *DisplayList) WriteFile(path string, format Format) (err error) {
+	var r Renderer
+	if format != JSONL {
+		if r, err = New(format, l.Width, l.Height); err != nil {
+			return err
+		}
+		l.Replay(r)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("Failed to save image: %v", err)
+	}
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("Failed to save image: %v", closeErr)
+		}
+	}()
+	if r == nil {
+		err = l.Encode(f)
+	} else {
+		_, err = r.WriteTo(f)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to save image: %v", err)
+	}
+	return nil
+}
+
+// ReadFile 读取 WriteFile 以 JSONL 格式保存的显示列表
+func ReadFile(path string) (*DisplayList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Decode(f)
+}
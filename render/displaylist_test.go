@@ -0,0 +1,82 @@
+package render
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 显示列表的 JSON lines 格式是稳定的，解码后得到相同的显示列表
+func TestEncodeDecode(t *testing.T) {
+	l := NewDisplayList(800, 600)
+	l.Add(&StyleOp{Style: Style{Color: Color{R: 0x12, G: 0xab, B: 0xff}, Width: 1.5, Join: JoinMiter, Cap: CapButt}})
+	l.Add(&PointOp{World: Point{1, -0.5}, Device: Point{500, 350}, Radius: 2})
+	l.Add(&PolylineOp{World: []Point{{0, 0}, {1, 1}}, Device: []Point{{400, 300}, {500, 200}}})
+	l.Add(&LabelOp{World: Point{0, 0}, Device: Point{400, 300}, Text: "sin \"x\"", Size: 12})
+
+	expected := `{"version":1,"width":800,"height":600}
+{"op":"style","color":"#12abff","width":1.5,"join":"miter","cap":"butt"}
+{"op":"point","world":[1,-0.5],"device":[500,350],"radius":2}
+{"op":"polyline","world":[[0,0],[1,1]],"device":[[400,300],[500,200]]}
+{"op":"label","world":[0,0],"device":[400,300],"text":"sin \"x\"","size":12}
+`
+
+	var sb strings.Builder
+	if err := l.Encode(&sb); err != nil {
+		t.Fatal(err)
+	}
+	if sb.String() != expected {
+		t.Fatalf("expected\n%s\nbut got\n%s", expected, sb.String())
+	}
+
+	decoded, err := Decode(strings.NewReader(expected))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, l) {
+		t.Errorf("expected %#v, but got %#v", l, decoded)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"", "Empty display list"},
+		{`{"version":2,"width":800,"height":600}`, "Line 1 of display list: unsupported version 2, expected 1"},
+		{`{"version":1,"width":0,"height":600}`, "Line 1 of display list: invalid canvas size 0x600"},
+		{"{\"version\":1,\"width\":8,\"height\":6}\n{\"op\":\"circle\"}", `Line 2 of display list: unknown operation "circle"`},
+		{"{\"version\":1,\"width\":8,\"height\":6}\n{\"op\":\"style\",\"color\":\"red\"}", `Line 2 of display list: Malformed color "red", expected #rrggbb`},
+		{"{\"version\":1,\"width\":8,\"height\":6}\n{\"op\":\"style\",\"color\":\"#000000\",\"join\":\"sharp\",\"cap\":\"butt\"}", `Line 2 of display list: unknown join "sharp"`},
+		{"{\"version\":1,\"width\":8,\"height\":6}\n{\"op\":\"style\",\"color\":\"#000000\",\"join\":\"round\"}", `Line 2 of display list: unknown cap ""`},
+		{"{\"version\":1,\"width\":8,\"height\":6}\n{\"op\":\"point\",\"world\":[1]}", "Line 2 of display list: Malformed point [1], expected [x, y]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := Decode(strings.NewReader(tt.input))
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("expected error %q, but got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestScale(t *testing.T) {
+	l := NewDisplayList(800, 600)
+	l.Add(&StyleOp{Style: Style{Width: 1, Join: JoinBevel, Cap: CapSquare}})
+	l.Add(&PointOp{World: Point{1, 2}, Device: Point{10, 20}, Radius: 2})
+	l.Add(&PolylineOp{World: []Point{{1, 2}}, Device: []Point{{10, 20}}})
+	l.Add(&LabelOp{World: Point{1, 2}, Device: Point{10, 20}, Text: "a", Size: 12})
+
+	expected := NewDisplayList(1600, 1200)
+	expected.Add(&StyleOp{Style: Style{Width: 2, Join: JoinBevel, Cap: CapSquare}})
+	expected.Add(&PointOp{World: Point{1, 2}, Device: Point{20, 40}, Radius: 4})
+	expected.Add(&PolylineOp{World: []Point{{1, 2}}, Device: []Point{{20, 40}}})
+	expected.Add(&LabelOp{World: Point{1, 2}, Device: Point{20, 40}, Text: "a", Size: 24})
+
+	if got := l.Scale(2); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %#v, but got %#v", expected, got)
+	}
+}
@@ -0,0 +1,116 @@
+package render
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// 显示列表的 JSON lines 格式：第一行是文件头，之后每行一个绘图操作，"op" 字段给出操作的类型
+//
+//	{"version":1,"width":800,"height":600}
+//	{"op":"style","color":"#000000","width":1,"join":"round","cap":"round"}
+//	{"op":"point","world":[1,0],"device":[500,300],"radius":2}
+//	{"op":"polyline","world":[[0,0],[1,1]],"device":[[400,300],[500,200]]}
+//	{"op":"label","world":[0,0],"device":[400,300],"text":"O","size":12}
+//
+// 字段的名字和含义只在升级 Version 时改变
+
+// Version 是当前显示列表格式的版本
+const Version = 1
+
+type header struct {
+	Version int `json:"version"`
+	Width   int `json:"width"`
+	Height  int `json:"height"`
+}
+
+// Encode 以 JSON lines 格式写出显示列表
+func (l *DisplayList) Encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	line, err := json.Marshal(header{Version: Version, Width: l.Width, Height: l.Height})
+	if err != nil {
+		return err
+	}
+	bw.Write(line)
+	bw.WriteByte('\n')
+
+	for _, op := range l.Ops {
+		fields, err := json.Marshal(op)
+		if err != nil {
+			return err
+		}
+		// 把 "op" 字段放在每行的最前面
+		fmt.Fprintf(bw, `{"op":%q,%s`, op.Kind(), fields[1:])
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// Decode 读取 Encode 写出的显示列表
+func Decode(r io.Reader) (*DisplayList, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20) // 一条折线可能很长
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("Empty display list")
+	}
+	var h header
+	if err := json.Unmarshal(scanner.Bytes(), &h); err != nil {
+		return nil, fmt.Errorf("Line 1 of display list: %v", err)
+	}
+	if h.Version != Version {
+		return nil, fmt.Errorf("Line 1 of display list: unsupported version %d, expected %d", h.Version, Version)
+	}
+	if h.Width <= 0 || h.Height <= 0 {
+		return nil, fmt.Errorf("Line 1 of display list: invalid canvas size %dx%d", h.Width, h.Height)
+	}
+
+	l := NewDisplayList(h.Width, h.Height)
+	for n := 2; scanner.Scan(); n++ {
+		line := scanner.Bytes()
+		var kind struct {
+			Op string `json:"op"`
+		}
+		if err := json.Unmarshal(line, &kind); err != nil {
+			return nil, fmt.Errorf("Line %d of display list: %v", n, err)
+		}
+		var op Op
+		switch kind.Op {
+		case "point":
+			op = &PointOp{}
+		case "polyline":
+			op = &PolylineOp{}
+		case "style":
+			op = &StyleOp{}
+		case "label":
+			op = &LabelOp{}
+		default:
+			return nil, fmt.Errorf("Line %d of display list: unknown operation %q", n, kind.Op)
+		}
+		if err := json.Unmarshal(line, op); err != nil {
+			return nil, fmt.Errorf("Line %d of display list: %v", n, err)
+		}
+		if style, ok := op.(*StyleOp); ok {
+			switch style.Join {
+			case JoinMiter, JoinRound, JoinBevel:
+			default:
+				return nil, fmt.Errorf("Line %d of display list: unknown join %q", n, style.Join)
+			}
+			switch style.Cap {
+			case CapButt, CapRound, CapSquare:
+			default:
+				return nil, fmt.Errorf("Line %d of display list: unknown cap %q", n, style.Cap)
+			}
+		}
+		l.Add(op)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
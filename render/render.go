@@ -0,0 +1,220 @@
+// Package render 记录解释器发出的绘图操作 (见 DisplayList)，并把它们输出为 PNG、SVG、PDF 或 EPS 图像。
+//
+// 绘图操作使用设备坐标：单位为像素，原点在画布左上角，y 轴向下，
+// 与坐标变换之后的屏幕坐标一致。矢量格式中一个像素对应一个 pt (1/72 英寸)
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"gonum.org/v1/plot/font"
+	"gonum.org/v1/plot/font/liberation"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/vgeps"
+	"gonum.org/v1/plot/vg/vgimg"
+	"gonum.org/v1/plot/vg/vgpdf"
+	"gonum.org/v1/plot/vg/vgsvg"
+	"image/color"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+// Canvas 接收设备坐标下的绘图操作
+type Canvas interface {
+	// Point 以 (x, y) 为圆心画一个半径为 r 像素的实心圆点
+	Point(x, y, r float64)
+	// Polyline 按当前样式的线宽、拐角和端点依次连接各点
+	Polyline(points []Point)
+	// SetStyle 改变之后的绘图操作使用的样式，画布开始时使用 DefaultStyle
+	SetStyle(style Style)
+	// Label 以 (x, y) 为左下角写一行字号为 size 像素的文字
+	Label(x, y float64, text string, size float64)
+}
+
+// Renderer 是某种图像格式的输出后端
+type Renderer interface {
+	Canvas
+	// WriteTo 把已经画好的图像编码后写入 w
+	WriteTo(w io.Writer) (int64, error)
+}
+
+// Format 是图像格式的名字，与文件扩展名相同但不带 "."
+type Format string
+
+const (
+	PNG Format = "png"
+	SVG Format = "svg"
+	PDF Format = "pdf"
+	EPS Format = "eps"
+
+	// JSONL 不是图像格式，而是 JSON lines 形式的显示列表，见 DisplayList.Encode
+	JSONL Format = "jsonl"
+)
+
+// Formats 按顺序列出支持的全部输出格式
+var Formats = []Format{PNG, SVG, PDF, EPS, JSONL}
+
+// ParseFormat 返回名字对应的图像格式，不区分大小写，例如命令行参数 -format svg
+func ParseFormat(name string) (Format, error) {
+	f := Format(strings.ToLower(name))
+	for _, known := range Formats {
+		if f == known {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("Unknown image format %q, expected one of %s", name, formatList())
+}
+
+// FormatOf 根据文件扩展名返回图像格式
+func FormatOf(path string) (Format, error) {
+	ext := filepath.Ext(path)
+	if ext == "" {
+		return "", fmt.Errorf("Cannot tell the image format of %q, expected an extension of %s", path, formatList())
+	}
+	f, err := ParseFormat(ext[1:])
+	if err != nil {
+		return "", fmt.Errorf("Unknown image format %q of %q, expected one of %s", ext, path, formatList())
+	}
+	return f, nil
+}
+
+// formatList 返回 "png, svg, pdf, eps" 形式的格式列表
+func formatList() string {
+	names := make([]string, len(Formats))
+	for k, f := range Formats {
+		names[k] = string(f)
+	}
+	return strings.Join(names, ", ")
+}
+
+// New 创建一个 width x height 像素、白色背景的画布，图像按 format 格式输出
+func New(format Format, width, height int) (Renderer, error) {
+	return NewWithBackground(format, width, height, color.White)
+}
+
+// NewWithBackground 与 New 相同，但以 background 填充背景；background 为 nil 或者完全透明时背景透明
+func NewWithBackground(format Format, width, height int, background color.Color) (Renderer, error) {
+	var c vg.CanvasWriterTo
+	switch format {
+	case PNG:
+		c = vgimg.PngCanvas{Canvas: newImageCanvas(width, height)}
+	case SVG:
+		c = vgsvg.New(vg.Length(width), vg.Length(height))
+	case PDF:
+		c = vgpdf.New(vg.Length(width), vg.Length(height))
+	case EPS:
+		c = epsCanvas{vgeps.New(vg.Length(width), vg.Length(height))}
+	case JSONL:
+		return nil, fmt.Errorf("%s is a display list, not an image format", format)
+	default:
+		return nil, fmt.Errorf("Unknown image format %q, expected one of %s", format, formatList())
+	}
+	return newVGRenderer(c, width, height, background), nil
+}
+
+// newImageCanvas 创建一个 width x height 像素的透明栅格画布
+func newImageCanvas(width, height int) *vgimg.Canvas {
+	// 72 DPI 时一个 pt 恰好是一个像素
+	return vgimg.NewWith(
+		vgimg.UseWH(vg.Length(width), vg.Length(height)),
+		vgimg.UseDPI(72),
+		vgimg.UseBackgroundColor(color.Transparent),
+	)
+}
+
+// newVGRenderer 在 c 上填充背景并设置默认样式
+func newVGRenderer(c vg.CanvasWriterTo, width, height int, background color.Color) *vgRenderer {
+	if background != nil {
+		if _, _, _, a := background.RGBA(); a != 0 {
+			w, h := vg.Length(width), vg.Length(height)
+			var rect vg.Path
+			rect.Move(vg.Point{})
+			rect.Line(vg.Point{X: w})
+			rect.Line(vg.Point{X: w, Y: h})
+			rect.Line(vg.Point{Y: h})
+			rect.Close()
+			c.SetColor(background)
+			c.Fill(rect)
+		}
+	}
+	r := &vgRenderer{canvas: c, width: float64(width), height: float64(height)}
+	r.SetStyle(DefaultStyle)
+	return r
+}
+
+// fonts 是 Label 使用的字体
+var fonts = font.NewCache(liberation.Collection())
+
+// vgRenderer 通过 gonum.org/v1/plot/vg 的后端输出图像
+type vgRenderer struct {
+	canvas vg.CanvasWriterTo
+	style  Style
+	width  float64 // 画布宽度
+	height float64 // 画布高度，vg 的原点在左下角，y 轴向上
+}
+
+// point 把设备坐标转换为 vg 的坐标
+func (r *vgRenderer) point(x, y float64) vg.Point {
+	return vg.Point{X: vg.Length(x), Y: vg.Length(r.height - y)}
+}
+
+func (r *vgRenderer) Point(x, y, radius float64) {
+	// 栅格化远在画布之外的图形非常慢，例如 TAN 渐近线附近的点，不在画布上的点直接跳过
+	if x+radius < 0 || x-radius > r.width || y+radius < 0 || y-radius > r.height {
+		return
+	}
+	var p vg.Path
+	center := r.point(x, y)
+	p.Move(vg.Point{X: center.X + vg.Length(radius), Y: center.Y})
+	p.Arc(center, vg.Length(radius), 0, 2*math.Pi)
+	p.Close()
+	r.canvas.Fill(p)
+}
+
+func (r *vgRenderer) Polyline(points []Point) {
+	pts := make([]vg.Point, len(points))
+	for k, p := range points {
+		pts[k] = r.point(p.X, p.Y)
+	}
+	// 先把折线裁剪到画布附近，边距足以容纳线宽、尖角和端点，裁剪产生的端点不会出现在画布上
+	margin := vg.Length(r.style.Width*miterLimit + 1)
+	for _, piece := range clipPolyline(pts, -margin, -margin, vg.Length(r.width)+margin, vg.Length(r.height)+margin) {
+		r.canvas.Fill(strokeOutline(piece, r.style))
+	}
+}
+
+func (r *vgRenderer) SetStyle(style Style) {
+	r.style = style
+	r.canvas.SetColor(style.Color)
+	r.canvas.SetLineWidth(vg.Length(style.Width))
+}
+
+func (r *vgRenderer) Label(x, y float64, text string, size float64) {
+	face := fonts.Lookup(font.Font{Typeface: "Liberation", Variant: "Sans"}, vg.Length(size))
+	r.canvas.FillString(face, r.point(x, y), text)
+}
+
+func (r *vgRenderer) WriteTo(w io.Writer) (int64, error) {
+	return r.canvas.WriteTo(w)
+}
+
+// epsCanvas 修正 vgeps 输出的文件头：vgeps 把第一行写成了 "%%!PS-Adobe-3.0 EPSF-3.0"，
+// 而 EPS 文件必须以 "%!PS-Adobe" 开始，否则 LaTeX 等工具无法识别
+type epsCanvas struct {
+	*vgeps.Canvas
+}
+
+func (c epsCanvas) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	if _, err := c.Canvas.WriteTo(&buf); err != nil {
+		return 0, err
+	}
+	out := buf.Bytes()
+	if bytes.HasPrefix(out, []byte("%%!PS-Adobe")) {
+		out = out[1:]
+	}
+	n, err := w.Write(out)
+	return int64(n), err
+}
@@ -0,0 +1,253 @@
+package render
+
+import (
+	"bytes"
+	"gonum.org/v1/plot/vg"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFormatOf(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected Format
+		err      string
+	}{
+		{path: "out.png", expected: PNG},
+		{path: "plots/figure.SVG", expected: SVG},
+		{path: "a.b.pdf", expected: PDF},
+		{path: "/tmp/x.eps", expected: EPS},
+		{path: "list.jsonl", expected: JSONL},
+		{path: "out", err: `Cannot tell the image format of "out", expected an extension of png, svg, pdf, eps, jsonl`},
+		{path: "out.jpg", err: `Unknown image format ".jpg" of "out.jpg", expected one of png, svg, pdf, eps, jsonl`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := FormatOf(tt.path)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, but got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %q, but got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// 每种格式的输出都以该格式的文件头开始
+func TestNew(t *testing.T) {
+	magic := map[Format]string{
+		PNG: "\x89PNG",
+		SVG: "<?xml",
+		PDF: "%PDF",
+		EPS: "%!PS-Adobe",
+	}
+
+	for _, format := range []Format{PNG, SVG, PDF, EPS} {
+		t.Run(string(format), func(t *testing.T) {
+			r, err := New(format, 80, 60)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Point(10, 20, 2)
+			r.SetStyle(Style{Color: Color{R: 0xff}, Width: 2})
+			r.Polyline([]Point{{0, 0}, {40, 30}, {80, 0}})
+			r.Label(5, 55, "y = x", 12)
+			var buf bytes.Buffer
+			if _, err := r.WriteTo(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(buf.String(), magic[format]) {
+				t.Errorf("expected output to start with %q, but got %q", magic[format], buf.String()[:10])
+			}
+		})
+	}
+
+	for _, format := range []Format{"gif", JSONL} {
+		if _, err := New(format, 80, 60); err == nil {
+			t.Errorf("expected an error for format %q", format)
+		}
+	}
+}
+
+// 重放的圆点出现在设备坐标指定的位置，y 轴向下
+func TestDisplayListWriteFile(t *testing.T) {
+	l := NewDisplayList(80, 60)
+	l.Add(&PointOp{Device: Point{10, 20}, Radius: 2})
+	l.Add(&PointOp{Device: Point{70, 50}, Radius: 2})
+
+	path := filepath.Join(t.TempDir(), "out.png")
+	if err := l.WriteFile(path, PNG); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 80 || b.Dy() != 60 {
+		t.Errorf("expected an 80x60 image, but got %v", b)
+	}
+	for _, p := range []struct {
+		x, y  int
+		drawn bool
+	}{{10, 20, true}, {70, 50, true}, {10, 40, false}, {40, 30, false}} {
+		r, _, _, _ := img.At(p.x, p.y).RGBA()
+		if got := r < 0x8000; got != p.drawn {
+			t.Errorf("expected point (%d, %d) drawn = %v, but got %v", p.x, p.y, p.drawn, got)
+		}
+	}
+}
+
+// 折线的端点和拐角样式：检查图像中若干像素是否被画到
+func TestPolyline(t *testing.T) {
+	horizontal := []Point{{20, 30}, {80, 30}}
+	corner := []Point{{20, 50}, {50, 10}, {80, 50}} // 拐角在 (50, 10)，外侧朝上
+	tests := []struct {
+		name   string
+		points []Point
+		style  Style
+		pixels map[[2]int]bool
+	}{
+		{"butt", horizontal, Style{Width: 10, Join: JoinRound, Cap: CapButt},
+			map[[2]int]bool{{50, 30}: true, {50, 37}: false, {17, 30}: false, {82, 30}: false}},
+		{"square", horizontal, Style{Width: 10, Join: JoinRound, Cap: CapSquare},
+			map[[2]int]bool{{17, 30}: true, {82, 30}: true, {16, 26}: true, {50, 37}: false}},
+		{"round", horizontal, Style{Width: 10, Join: JoinRound, Cap: CapRound},
+			map[[2]int]bool{{17, 30}: true, {82, 30}: true, {15, 25}: false}},
+		{"miter", corner, Style{Width: 10, Join: JoinMiter, Cap: CapButt},
+			map[[2]int]bool{{50, 3}: true, {50, 5}: true, {50, 20}: false}},
+		{"round join", corner, Style{Width: 10, Join: JoinRound, Cap: CapButt},
+			map[[2]int]bool{{50, 3}: false, {50, 5}: true}},
+		{"bevel", corner, Style{Width: 10, Join: JoinBevel, Cap: CapButt},
+			map[[2]int]bool{{50, 3}: false, {50, 5}: false, {50, 8}: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewDisplayList(100, 60)
+			l.Add(&StyleOp{Style: tt.style})
+			l.Add(&PolylineOp{Device: tt.points})
+			path := filepath.Join(t.TempDir(), "out.png")
+			if err := l.WriteFile(path, PNG); err != nil {
+				t.Fatal(err)
+			}
+			expectPixels(t, path, tt.pixels)
+		})
+	}
+}
+
+// expectPixels 检查 PNG 图像中的像素是否被画到
+func expectPixels(t *testing.T, path string, pixels map[[2]int]bool) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, drawn := range pixels {
+		r, _, _, _ := img.At(p[0], p[1]).RGBA()
+		if got := r < 0x8000; got != drawn {
+			t.Errorf("expected pixel (%d, %d) drawn = %v, but got %v", p[0], p[1], drawn, got)
+		}
+	}
+}
+
+func TestClipPolyline(t *testing.T) {
+	p := func(x, y vg.Length) vg.Point { return vg.Point{X: x, Y: y} }
+	tests := []struct {
+		name     string
+		points   []vg.Point
+		expected [][]vg.Point
+	}{
+		{"inside", []vg.Point{p(1, 1), p(5, 5), p(9, 1)}, [][]vg.Point{{p(1, 1), p(5, 5), p(9, 1)}}},
+		{"point outside", []vg.Point{p(20, 5)}, nil},
+		{"crossing", []vg.Point{p(-10, 5), p(5, 5), p(5, 1e9)}, [][]vg.Point{{p(0, 5), p(5, 5), p(5, 10)}}},
+		{"leaves and returns", []vg.Point{p(5, 5), p(5, 20), p(8, 20), p(8, 5)},
+			[][]vg.Point{{p(5, 5), p(5, 10)}, {p(8, 10), p(8, 5)}}},
+		{"outside", []vg.Point{p(-5, -5), p(-5, 20), p(20, 20)}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := clipPolyline(tt.points, 0, 0, 10, 10)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, but got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// 远在画布之外的点和折线被裁掉，不会拖慢栅格化
+func TestFarOffCanvas(t *testing.T) {
+	l := NewDisplayList(100, 60)
+	l.Add(&PointOp{Device: Point{50, -1e8}, Radius: 2})
+	l.Add(&StyleOp{Style: Style{Width: 4, Join: JoinRound, Cap: CapRound}})
+	l.Add(&PolylineOp{Device: []Point{{50, 30}, {50, 1e9}}})
+	path := filepath.Join(t.TempDir(), "out.png")
+	if err := l.WriteFile(path, PNG); err != nil {
+		t.Fatal(err)
+	}
+	expectPixels(t, path, map[[2]int]bool{{50, 45}: true, {50, 25}: false})
+}
+
+// 背景可以是任意颜色或者透明
+func TestImage(t *testing.T) {
+	l := NewDisplayList(40, 30)
+	l.Add(&PointOp{Device: Point{10, 10}, Radius: 3})
+
+	tests := []struct {
+		name       string
+		background color.Color
+		corner     color.NRGBA
+	}{
+		{"white", color.White, color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}},
+		{"red", Color{R: 0xff}, color.NRGBA{R: 0xff, A: 0xff}},
+		{"transparent", nil, color.NRGBA{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := l.Write(&buf, PNG, tt.background); err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := png.Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, img := range []image.Image{l.Image(tt.background), decoded} {
+				if b := img.Bounds(); b.Dx() != 40 || b.Dy() != 30 {
+					t.Fatalf("expected a 40x30 image, but got %v", b)
+				}
+				if got := color.NRGBAModel.Convert(img.At(35, 25)); got != tt.corner {
+					t.Errorf("expected background %v, but got %v", tt.corner, got)
+				}
+				if got := color.NRGBAModel.Convert(img.At(10, 10)); got != (color.NRGBA{A: 0xff}) {
+					t.Errorf("expected a black point, but got %v", got)
+				}
+			}
+		})
+	}
+}
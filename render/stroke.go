@@ -0,0 +1,211 @@
+package render
+
+import (
+	"gonum.org/v1/plot/vg"
+	"math"
+)
+
+// vg 的后端只支持设置线宽，不能设置拐角和端点的样式，而且各后端的默认样式不同。
+// 因此折线不直接交给后端描边，而是先算出描边之后的轮廓：每一段是一个矩形，
+// 再加上拐角和端点处的多边形或圆，最后作为一条路径一次填充。
+// 所有子路径都是逆时针方向，以非零环绕规则填充时重叠的部分不会互相抵消
+
+// miterLimit 是尖角长度与半线宽之比的上限，超过时改用斜角，与 SVG 的默认值相同
+const miterLimit = 4
+
+// vec 是用于计算轮廓的二维向量
+type vec struct {
+	x, y float64
+}
+
+func (a vec) add(b vec) vec         { return vec{a.x + b.x, a.y + b.y} }
+func (a vec) sub(b vec) vec         { return vec{a.x - b.x, a.y - b.y} }
+func (a vec) mul(k float64) vec     { return vec{a.x * k, a.y * k} }
+func (a vec) dot(b vec) float64     { return a.x*b.x + a.y*b.y }
+func (a vec) cross(b vec) float64   { return a.x*b.y - a.y*b.x }
+func (a vec) normal() vec           { return vec{-a.y, a.x} }
+func (a vec) unit() vec             { return a.mul(1 / math.Hypot(a.x, a.y)) }
+func (a vec) point() vg.Point       { return vg.Point{X: vg.Length(a.x), Y: vg.Length(a.y)} }
+func (a vec) equal(b vec) bool      { return a.x == b.x && a.y == b.y }
+func (a vec) scaleTo(h float64) vec { return a.unit().mul(h) }
+
+// strokeOutline 返回以 style 描边 points 得到的轮廓，坐标为 vg 的坐标 (y 轴向上)
+func strokeOutline(points []vg.Point, style Style) vg.Path {
+	var path vg.Path
+	h := style.Width / 2
+	if !(h > 0) {
+		return path
+	}
+
+	// 去掉重复的点，长度为零的线段没有方向
+	var pts []vec
+	for _, p := range points {
+		v := vec{float64(p.X), float64(p.Y)}
+		if len(pts) == 0 || !v.equal(pts[len(pts)-1]) {
+			pts = append(pts, v)
+		}
+	}
+
+	switch {
+	case len(pts) == 0:
+		return path
+	case len(pts) == 1:
+		// 只有一个点时按端点样式画一个点，平头端点不画任何东西
+		p := pts[0]
+		switch style.Cap {
+		case CapRound:
+			circle(&path, p, h)
+		case CapSquare:
+			polygon(&path, vec{p.x - h, p.y - h}, vec{p.x + h, p.y - h}, vec{p.x + h, p.y + h}, vec{p.x - h, p.y + h})
+		}
+		return path
+	}
+
+	// 每一段线段
+	for k := 0; k+1 < len(pts); k++ {
+		a, b := pts[k], pts[k+1]
+		n := b.sub(a).normal().scaleTo(h)
+		polygon(&path, a.add(n), b.add(n), b.sub(n), a.sub(n))
+	}
+
+	// 拐角
+	for k := 1; k+1 < len(pts); k++ {
+		join(&path, pts[k], pts[k].sub(pts[k-1]).unit(), pts[k+1].sub(pts[k]).unit(), h, style.Join)
+	}
+
+	// 两端
+	first, last := pts[0], pts[len(pts)-1]
+	lineCap(&path, first, first.sub(pts[1]).unit(), h, style.Cap)
+	lineCap(&path, last, last.sub(pts[len(pts)-2]).unit(), h, style.Cap)
+	return path
+}
+
+// clipPolyline 把折线裁剪到矩形 [x0, x1] x [y0, y1] 之内，返回留在矩形中的各段折线
+func clipPolyline(points []vg.Point, x0, y0, x1, y1 vg.Length) [][]vg.Point {
+	inside := func(p vg.Point) bool { return p.X >= x0 && p.X <= x1 && p.Y >= y0 && p.Y <= y1 }
+	if len(points) == 1 {
+		if inside(points[0]) {
+			return [][]vg.Point{points}
+		}
+		return nil
+	}
+
+	var pieces [][]vg.Point
+	var piece []vg.Point
+	for k := 0; k+1 < len(points); k++ {
+		a, b := points[k], points[k+1]
+		t0, t1, ok := clipSegment(a, b, x0, y0, x1, y1)
+		if !ok {
+			continue
+		}
+		d := b.Sub(a)
+		if t0 > 0 || len(piece) == 0 {
+			// 线段从矩形外进入，开始新的一段
+			if len(piece) > 0 {
+				pieces = append(pieces, piece)
+			}
+			piece = []vg.Point{a.Add(d.Scale(vg.Length(t0)))}
+		}
+		piece = append(piece, a.Add(d.Scale(vg.Length(t1))))
+		if t1 < 1 {
+			// 线段离开矩形
+			pieces = append(pieces, piece)
+			piece = nil
+		}
+	}
+	if len(piece) > 0 {
+		pieces = append(pieces, piece)
+	}
+	return pieces
+}
+
+// clipSegment 用 Liang-Barsky 算法把线段 ab 裁剪到矩形中，返回留下部分的参数范围 [t0, t1]
+func clipSegment(a, b vg.Point, x0, y0, x1, y1 vg.Length) (t0, t1 float64, ok bool) {
+	t0, t1 = 0, 1
+	dx, dy := float64(b.X-a.X), float64(b.Y-a.Y)
+	for _, edge := range [4][2]float64{
+		{-dx, float64(a.X - x0)},
+		{dx, float64(x1 - a.X)},
+		{-dy, float64(a.Y - y0)},
+		{dy, float64(y1 - a.Y)},
+	} {
+		p, q := edge[0], edge[1]
+		switch {
+		case p == 0:
+			if q < 0 {
+				return 0, 0, false
+			}
+		case p < 0:
+			t0 = max(t0, q/p)
+		default:
+			t1 = min(t1, q/p)
+		}
+	}
+	return t0, t1, t0 <= t1
+}
+
+// join 在 p 处连接方向为 d0 和 d1 的两段线段
+func join(path *vg.Path, p, d0, d1 vec, h float64, style Join) {
+	if style == JoinRound {
+		circle(path, p, h)
+		return
+	}
+	cross := d0.cross(d1)
+	if math.Abs(cross) < 1e-12 {
+		return // 同向时不需要拐角，反向时尖角无穷长，改用斜角也就是不画
+	}
+	// 拐角在转弯方向的另一侧
+	side := -math.Copysign(1, cross)
+	o0 := d0.normal().mul(side * h)
+	o1 := d1.normal().mul(side * h)
+
+	if style == JoinMiter {
+		bisector := o0.add(o1).unit()
+		length := h / bisector.dot(o0.mul(1/h))
+		if length/h <= miterLimit {
+			polygon(path, p, p.add(o0), p.add(bisector.mul(length)), p.add(o1))
+			return
+		}
+	}
+	polygon(path, p, p.add(o0), p.add(o1))
+}
+
+// lineCap 在端点 p 处画端点，d 是从线段指向端点外侧的方向
+func lineCap(path *vg.Path, p, d vec, h float64, style Cap) {
+	switch style {
+	case CapRound:
+		circle(path, p, h)
+	case CapSquare:
+		n := d.normal().mul(h)
+		e := d.mul(h)
+		polygon(path, p.add(n), p.add(n).add(e), p.sub(n).add(e), p.sub(n))
+	}
+}
+
+// polygon 把多边形按逆时针方向加入路径
+func polygon(path *vg.Path, pts ...vec) {
+	var area float64
+	for k, a := range pts {
+		area += a.cross(pts[(k+1)%len(pts)])
+	}
+	if area == 0 {
+		return
+	}
+	if area < 0 {
+		for i, j := 0, len(pts)-1; i < j; i, j = i+1, j-1 {
+			pts[i], pts[j] = pts[j], pts[i]
+		}
+	}
+	path.Move(pts[0].point())
+	for _, p := range pts[1:] {
+		path.Line(p.point())
+	}
+	path.Close()
+}
+
+// circle 把以 c 为圆心、r 为半径的圆按逆时针方向加入路径
+func circle(path *vg.Path, c vec, r float64) {
+	path.Move(vec{c.x + r, c.y}.point())
+	path.Arc(c.point(), vg.Length(r), 0, 2*math.Pi)
+	path.Close()
+}
@@ -0,0 +1,207 @@
+package semantic
+
+import (
+	"compilers/render"
+	"container/heap"
+	"maps"
+	"math"
+	"slices"
+)
+
+// DefaultTolerance 是 STEP ADAPTIVE 没有给出 TOLERANCE 时折线与曲线在屏幕上的最大偏差，单位为像素
+const DefaultTolerance = 0.5
+
+// MaxAdaptiveSamples 是一次自适应 FOR 循环最多使用的采样点数
+const MaxAdaptiveSamples = 10000
+
+// adaptiveGrid 是自适应采样开始时把参数区间等分的份数，
+// 避免只看中点时漏掉周期恰好与区间长度相同的起伏
+const adaptiveGrid = 32
+
+// adaptiveDepth 是区间最多被对分的次数，曲线不连续时在此停止细分
+const adaptiveDepth = 24
+
+// ParseAdaptiveForStatement 执行 FOR 变量 FROM 起点 TO 终点 STEP ADAPTIVE TOLERANCE 容差 循环体。
+//
+// 先在参数区间上试探执行循环体 (见 Probe)，对屏幕上偏离折线超过 tolerance 像素的区间反复对分，
+// 偏差最大的区间先对分，采样点总数不超过 MaxAdaptiveSamples；
+// 然后按参数从 start 到 end 的顺序在选出的采样点上正式执行循环体，start 大于 end 时参数递减
+func (s *State) ParseAdaptiveForStatement(loopVar string, start, end, tolerance float64, body func() error) error {
+	s.PushScope()
+	defer s.PopScope()
+	s.loops = append(s.loops, &curveSet{open: make(map[interface{}]*curve)})
+	defer s.endLoop()
+
+	samples, err := s.adaptiveSamples(loopVar, start, end, tolerance, body)
+	if err != nil {
+		return err
+	}
+	if start > end {
+		slices.Reverse(samples)
+	}
+	for _, t := range samples {
+		s.Define(loopVar, t)
+		if err := body(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// probe 记录试探执行中画出的点
+type probe struct {
+	points []render.Point
+}
+
+// Probing 报告是否正在试探执行，此时解释器不应输出信息或写入文件
+func (s *State) Probing() bool {
+	return s.probe != nil
+}
+
+// Probe 试探执行 fn，按顺序返回其中 DRAW 画出的点的设备坐标，NaN 或无穷的点也照样记录。
+// 试探执行时不画到画布上，结束后恢复变量、坐标变换和画笔，fn 中的赋值等语句不留下影响
+func (s *State) Probe(fn func() error) ([]render.Point, error) {
+	variables := maps.Clone(s.globals)
+	scopes := make([]map[string]float64, len(s.scopes))
+	for k, scope := range s.scopes {
+		scopes[k] = maps.Clone(scope)
+	}
+	transform, pen, stack, outer := s.Transform, s.Pen, slices.Clone(s.stack), s.probe
+	s.probe = &probe{}
+	defer func() {
+		s.globals, s.scopes = variables, scopes
+		s.Transform, s.Pen, s.stack, s.probe = transform, pen, stack, outer
+	}()
+
+	err := fn()
+	return s.probe.points, err
+}
+
+// interval 是自适应采样中的一个参数区间，mid 是区间中点，dev 是中点偏离两端连线的距离
+type interval struct {
+	a, b, mid    float64
+	pa, pb, pmid []render.Point
+	dev          float64
+	depth        int
+}
+
+// intervalHeap 是按偏差从大到小排列的区间
+type intervalHeap []*interval
+
+func (h intervalHeap) Len() int            { return len(h) }
+func (h intervalHeap) Less(i, j int) bool  { return h[i].dev > h[j].dev }
+func (h intervalHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *intervalHeap) Push(x interface{}) { *h = append(*h, x.(*interval)) }
+func (h *intervalHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// adaptiveSamples 返回按从小到大排列的采样点，start 和 end 的大小顺序不限
+func (s *State) adaptiveSamples(loopVar string, start, end, tolerance float64, body func() error) ([]float64, error) {
+	var samples []float64
+	sample := func(t float64) ([]render.Point, error) {
+		samples = append(samples, t)
+		s.Define(loopVar, t)
+		return s.Probe(body)
+	}
+	newInterval := func(a, b float64, pa, pb []render.Point, depth int) (*interval, error) {
+		mid := a + (b-a)/2
+		pmid, err := sample(mid)
+		if err != nil {
+			return nil, err
+		}
+		return &interval{a: a, b: b, mid: mid, pa: pa, pb: pb, pmid: pmid, dev: deviation(pa, pmid, pb), depth: depth}, nil
+	}
+
+	if start == end {
+		return []float64{start}, nil
+	}
+	points := make([][]render.Point, adaptiveGrid+1)
+	for k := range points {
+		t := start + (end-start)*float64(k)/adaptiveGrid
+		if k == adaptiveGrid {
+			t = end
+		}
+		var err error
+		if points[k], err = sample(t); err != nil {
+			return nil, err
+		}
+	}
+	var h intervalHeap
+	for k := 0; k < adaptiveGrid; k++ {
+		in, err := newInterval(samples[k], samples[k+1], points[k], points[k+1], 0)
+		if err != nil {
+			return nil, err
+		}
+		h = append(h, in)
+	}
+	heap.Init(&h)
+
+	// 每次对分增加两个采样点
+	for h.Len() > 0 && len(samples)+2 <= MaxAdaptiveSamples {
+		in := heap.Pop(&h).(*interval)
+		if in.dev <= tolerance {
+			break
+		}
+		if in.depth >= adaptiveDepth {
+			continue
+		}
+		left, err := newInterval(in.a, in.mid, in.pa, in.pmid, in.depth+1)
+		if err != nil {
+			return nil, err
+		}
+		right, err := newInterval(in.mid, in.b, in.pmid, in.pb, in.depth+1)
+		if err != nil {
+			return nil, err
+		}
+		heap.Push(&h, left)
+		heap.Push(&h, right)
+	}
+
+	slices.Sort(samples)
+	return slices.Compact(samples), nil
+}
+
+// deviation 返回循环体在区间中点画出的点偏离两端对应点连线的最大距离。
+// 画出的点数不同，或者只有一部分点是 NaN 或无穷时，返回 +Inf 使区间继续对分，
+// 以便找到曲线断开的位置
+func deviation(a, mid, b []render.Point) float64 {
+	if len(a) != len(mid) || len(b) != len(mid) {
+		return math.Inf(1)
+	}
+	var dev float64
+	for k := range mid {
+		finite := 0
+		for _, p := range []render.Point{a[k], mid[k], b[k]} {
+			if isFinite(p) {
+				finite++
+			}
+		}
+		switch finite {
+		case 0:
+			continue
+		case 3:
+			dev = max(dev, segmentDistance(mid[k], a[k], b[k]))
+		default:
+			return math.Inf(1)
+		}
+	}
+	return dev
+}
+
+// segmentDistance 返回点 p 到线段 ab 的距离
+func segmentDistance(p, a, b render.Point) float64 {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	var u float64
+	if l := dx*dx + dy*dy; l > 0 {
+		u = min(max(((p.X-a.X)*dx+(p.Y-a.Y)*dy)/l, 0), 1)
+	}
+	return math.Hypot(p.X-a.X-u*dx, p.Y-a.Y-u*dy)
+}
+
+func isFinite(p render.Point) bool {
+	return !math.IsNaN(p.X) && !math.IsNaN(p.Y) && !math.IsInf(p.X, 0) && !math.IsInf(p.Y, 0)
+}
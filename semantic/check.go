@@ -0,0 +1,423 @@
+package semantic
+
+import (
+	"compilers/builtin"
+	"compilers/parser"
+	"compilers/render"
+	"compilers/token"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// Check 在执行之前检查整个程序，按源代码顺序返回发现的全部问题：
+// 未定义的变量、函数参数个数错误、给 PI / E 等常量赋值、
+// 步长为零或与循环方向相反的 FOR 语句，分量个数不对的 DRAW、TRANSFORM 语句，
+// 不匹配的 PUSH / POP，不是正数的 WIDTH，以及文件名为空或者图像格式未知的 OUTPUT 语句。
+// FOR 循环体中的变量在第一次迭代赋值之前的使用同样报告，
+// 但 IF 分支中的使用和赋值都按可能执行处理，只在执行时才能发现其中未定义的变量。
+// predeclared 是执行之前已经定义的全局变量，例如嵌入程序时注入的参数。
+// 返回空切片表示程序可以执行
+func Check(statements []parser.Statement, predeclared ...string) []parser.Diagnostic {
+	c := &checker{
+		scopes:    []map[string]token.Pos{make(map[string]token.Pos)},
+		functions: make(map[string]*parser.FunctionDeclaration),
+		loopVars:  make(map[string]token.Pos),
+	}
+	for _, name := range predeclared {
+		c.scopes[0][name] = token.Pos{}
+	}
+	for _, stmt := range statements {
+		c.statement(stmt)
+	}
+
+	// 函数体在调用时求值，可以使用在声明之后才赋值的全局变量，
+	// 因此等整个程序检查完、全局符号表完整之后再检查函数体
+	globals := c.scopes[0]
+	c.inBodies = true
+	for _, fn := range c.bodies {
+		params := make(map[string]token.Pos, len(fn.Params))
+		for _, param := range fn.Params {
+			params[param] = fn.Pos()
+		}
+		c.scopes = []map[string]token.Pos{globals, params}
+		c.expression(fn.Body)
+	}
+	// 函数体用到的全局变量和函数必须在每次调用之前已经赋值或声明
+	for _, call := range c.calls {
+		c.callSite(call, globals)
+	}
+
+	c.unmatchedPushes(0)
+
+	sort.SliceStable(c.diagnostics, func(a, b int) bool {
+		return c.diagnostics[a].Pos.Offset < c.diagnostics[b].Pos.Offset
+	})
+	return c.diagnostics
+}
+
+// constants 是不能被赋值的命名常量
+var constants = map[string]float64{
+	"PI": math.Pi,
+	"E":  math.E,
+}
+
+// ConstantValue 返回常量字面值的数值：PI、E 或者十进制数
+func ConstantValue(lit string) (float64, error) {
+	if val, ok := constants[lit]; ok {
+		return val, nil
+	}
+	val, err := strconv.ParseFloat(lit, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Malformed number literal %q", lit)
+	}
+	return val, nil
+}
+
+// checker 保存语义检查过程中的符号表
+type checker struct {
+	scopes      []map[string]token.Pos                 // 变量作用域栈，值为变量第一次赋值结束的位置；scopes[0] 为全局变量
+	functions   map[string]*parser.FunctionDeclaration // 已声明的用户自定义函数
+	loopVars    map[string]token.Pos                   // 已结束的循环变量及其 FOR 语句位置
+	bodies      []*parser.FunctionDeclaration          // 等待检查的函数体
+	calls       []*parser.FunctionCallExpression       // 函数体之外对用户自定义函数的调用
+	unassigned  map[string]bool                        // 当前 FOR 循环体中已经加入作用域、但按顺序检查时尚未赋值的变量
+	conditional bool                                   // 正在检查当前 FOR 循环体中 IF 语句的分支
+	inBodies    bool                                   // 正在检查函数体
+	pushes      []token.Pos                            // 尚未 POP 的 PUSH 语句的位置
+	pushBase    int                                    // 当前分支或循环体开始时 pushes 的长度
+	diagnostics []parser.Diagnostic
+}
+
+func (c *checker) errorf(pos token.Pos, format string, args ...interface{}) {
+	c.diagnostics = append(c.diagnostics, parser.Diagnostic{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+// lookup 由内向外查找变量
+func (c *checker) lookup(name string) bool {
+	for k := len(c.scopes) - 1; k >= 0; k-- {
+		if _, ok := c.scopes[k][name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// assign 与 State.Assign 一致：已定义的变量原地更新，否则在最内层作用域中定义
+func (c *checker) assign(name string, pos token.Pos) {
+	if !c.lookup(name) {
+		c.scopes[len(c.scopes)-1][name] = pos
+	}
+}
+
+func (c *checker) statement(stmt parser.Statement) {
+	switch stmt := stmt.(type) {
+	case *parser.OriginStatement:
+		c.expression(stmt.X)
+		c.expression(stmt.Y)
+	case *parser.ScaleStatement:
+		c.expression(stmt.X)
+		c.expression(stmt.Y)
+	case *parser.RotStatement:
+		c.expression(stmt.Angle)
+	case *parser.ShearStatement:
+		c.expression(stmt.X)
+		c.expression(stmt.Y)
+	case *parser.ReflectStatement:
+		c.expression(stmt.Angle)
+	case *parser.TransformStatement:
+		if n := len(stmt.Components); n != 6 {
+			c.errorf(stmt.Pos(), "TRANSFORM expects 6 components (a, b, c, d, e, f), got %d", n)
+		}
+		for _, component := range stmt.Components {
+			c.expression(component)
+		}
+	case *parser.TransformModeStatement:
+	case *parser.PushStatement:
+		c.pushes = append(c.pushes, stmt.Pos())
+	case *parser.PopStatement:
+		if len(c.pushes) == c.pushBase {
+			c.errorf(stmt.Pos(), "POP without matching PUSH")
+			return
+		}
+		c.pushes = c.pushes[:len(c.pushes)-1]
+	case *parser.DrawModeStatement, *parser.JoinStatement, *parser.CapStatement:
+	case *parser.WidthStatement:
+		c.expression(stmt.Width)
+		if width, ok := constant(stmt.Width); ok && (!(width > 0) || math.IsInf(width, 0)) {
+			c.errorf(stmt.Width.Pos(), "WIDTH must be a positive number, got %v", width)
+		}
+	case *parser.OutputStatement:
+		if stmt.Path == "" {
+			c.errorf(stmt.Pos(), "OUTPUT file name is empty")
+		} else if _, err := render.FormatOf(stmt.Path); err != nil {
+			c.errorf(stmt.Pos(), "%v", err)
+		}
+	case *parser.AssignmentStatement:
+		c.expression(stmt.Value)
+		if _, ok := constants[stmt.Identifier]; ok {
+			c.errorf(stmt.Pos(), "Cannot assign to constant %s", stmt.Identifier)
+			return
+		}
+		c.assign(stmt.Identifier, stmt.EndPos())
+		delete(c.unassigned, stmt.Identifier)
+	case *parser.DrawStatement:
+		if n := len(stmt.Components); n != 2 {
+			c.errorf(stmt.Pos(), "DRAW expects 2 components (x, y), got %d", n)
+		}
+		for _, component := range stmt.Components {
+			c.expression(component)
+		}
+	case *parser.BlockStatement:
+		for _, s := range stmt.Statements {
+			c.statement(s)
+		}
+	case *parser.IfStatement:
+		// 任一分支中的赋值都视为定义了变量，避免误报
+		c.expression(stmt.Condition)
+		conditional := c.conditional
+		c.conditional = true
+		c.balanced(stmt.Then)
+		if stmt.Else != nil {
+			c.balanced(stmt.Else)
+		}
+		c.conditional = conditional
+	case *parser.FunctionDeclaration:
+		if prev, ok := c.functions[stmt.Name]; ok {
+			c.errorf(stmt.Pos(), "Function %s already declared at %s", stmt.Name, prev.Pos())
+			return
+		}
+		c.functions[stmt.Name] = stmt
+		c.bodies = append(c.bodies, stmt)
+	case *parser.ExpressionStatement:
+		c.expression(stmt.X)
+	case *parser.ForStatement:
+		c.forStatement(stmt)
+	case *parser.CommentStatement:
+	}
+}
+
+func (c *checker) forStatement(stmt *parser.ForStatement) {
+	c.expression(stmt.Start)
+	c.expression(stmt.End)
+	if stmt.Adaptive {
+		if stmt.Tolerance != nil {
+			c.expression(stmt.Tolerance)
+			if tol, ok := constant(stmt.Tolerance); ok && (!(tol > 0) || math.IsInf(tol, 0)) {
+				c.errorf(stmt.Tolerance.Pos(), "TOLERANCE must be a positive number, got %v", tol)
+			}
+		}
+	} else {
+		c.expression(stmt.Step)
+		if step, ok := constant(stmt.Step); ok && !math.IsNaN(step) {
+			start, startOK := constant(stmt.Start)
+			end, endOK := constant(stmt.End)
+			switch {
+			case step == 0:
+				c.errorf(stmt.Step.Pos(), "STEP of FOR %s is zero, the loop would never end", stmt.LoopVar)
+			case startOK && endOK && start != end && (end-start > 0) != (step > 0):
+				c.errorf(stmt.Step.Pos(), "STEP %v of FOR %s never reaches %v from %v", step, stmt.LoopVar, end, start)
+			}
+		}
+	}
+
+	// 与执行时一致，循环变量不能遮蔽已有的变量
+	if c.lookup(stmt.LoopVar) {
+		c.errorf(stmt.Pos(), "Loop variable %s shadows an existing variable", stmt.LoopVar)
+	}
+
+	// 循环体在新的作用域中执行，作用域在整个循环期间保留，
+	// 因此循环体中赋值的变量在之后的迭代中都可见。
+	// 嵌套的 FOR 语句有自己的作用域，其中赋值的变量随内层循环结束而消失
+	scope := map[string]token.Pos{stmt.LoopVar: stmt.Pos()}
+	parser.Inspect(stmt.Body, func(n parser.Node) bool {
+		switch n := n.(type) {
+		case *parser.ForStatement:
+			return false
+		case *parser.AssignmentStatement:
+			if !c.lookup(n.Identifier) {
+				scope[n.Identifier] = n.EndPos()
+			}
+		}
+		return true
+	})
+	// 第一次迭代时这些变量还没有赋值，在赋值之前一定会执行到的使用都是错误。
+	// IF 分支中的使用可能只在之后的迭代中执行，不报告。
+	// 内层循环至少执行一次，外层循环体中尚未赋值的变量在内层同样不可用；
+	// 这时内层的赋值定义的是内层的变量，对外层无效
+	outer, conditional := c.unassigned, c.conditional
+	c.unassigned = make(map[string]bool)
+	for name := range scope {
+		if name != stmt.LoopVar {
+			c.unassigned[name] = true
+		}
+	}
+	if !conditional {
+		for name := range outer {
+			c.unassigned[name] = true
+		}
+	}
+	c.conditional = false
+	c.scopes = append(c.scopes, scope)
+	c.balanced(stmt.Body)
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.unassigned, c.conditional = outer, conditional
+
+	c.loopVars[stmt.LoopVar] = stmt.Pos()
+}
+
+// balanced 检查 FOR 循环体或者 IF 分支。其中的 PUSH 和 POP 必须互相匹配，
+// 否则变换栈的深度会随循环次数或所走的分支而变化
+func (c *checker) balanced(stmt parser.Statement) {
+	base := c.pushBase
+	c.pushBase = len(c.pushes)
+	c.statement(stmt)
+	c.unmatchedPushes(c.pushBase)
+	c.pushBase = base
+}
+
+// unmatchedPushes 报告 pushes[base:] 中没有匹配 POP 的 PUSH 语句
+func (c *checker) unmatchedPushes(base int) {
+	for _, pos := range c.pushes[base:] {
+		c.errorf(pos, "PUSH without matching POP")
+	}
+	c.pushes = c.pushes[:base]
+}
+
+// expression 检查表达式中用到的变量和函数调用
+func (c *checker) expression(expr parser.Expression) {
+	parser.Inspect(expr, func(n parser.Node) bool {
+		switch n := n.(type) {
+		case *parser.VariableExpression:
+			c.variable(n)
+		case *parser.FunctionCallExpression:
+			c.call(n)
+		}
+		return true
+	})
+}
+
+func (c *checker) variable(v *parser.VariableExpression) {
+	if c.lookup(v.Name) {
+		if c.unassigned[v.Name] && !c.conditional {
+			c.errorf(v.Pos(), "Variable %s is used before it is assigned in the FOR body", v.Name)
+		}
+		return
+	}
+	if pos, ok := c.loopVars[v.Name]; ok {
+		c.errorf(v.Pos(), "Loop variable %s is only visible inside the FOR statement at %s", v.Name, pos)
+		return
+	}
+	c.errorf(v.Pos(), "Undefined variable: %s", v.Name)
+}
+
+func (c *checker) call(call *parser.FunctionCallExpression) {
+	// 用户自定义函数优先于内置函数
+	if fn, ok := c.functions[call.Name]; ok {
+		if !c.inBodies {
+			c.calls = append(c.calls, call)
+		}
+		if len(call.Arguments) != len(fn.Params) {
+			c.errorf(call.Pos(), "Function %s expects %d argument(s), got %d", fn.Name, len(fn.Params), len(call.Arguments))
+		}
+		return
+	}
+	fn, ok := builtin.Lookup(call.Name)
+	if !ok {
+		c.errorf(call.Pos(), "Unknown function: %s", call.Name)
+		return
+	}
+	if err := fn.CheckArity(len(call.Arguments)); err != nil {
+		c.errorf(call.Pos(), "%v", err)
+	}
+}
+
+// callSite 检查 call 调用的函数，以及它直接或间接调用的函数，
+// 用到的全局变量在调用之前已经赋值，调用的函数在调用之前已经声明。
+// 解释器按语句顺序定义全局变量和登记函数，之后才赋值或声明的在这次调用中不可见
+func (c *checker) callSite(call *parser.FunctionCallExpression, globals map[string]token.Pos) {
+	before := func(pos token.Pos) bool {
+		return !pos.IsValid() || pos.Offset <= call.Pos().Offset
+	}
+	visited := make(map[string]bool)
+	reported := make(map[string]bool)
+	var visit func(fn *parser.FunctionDeclaration)
+	visit = func(fn *parser.FunctionDeclaration) {
+		visited[fn.Name] = true
+		parser.Inspect(fn.Body, func(n parser.Node) bool {
+			switch n := n.(type) {
+			case *parser.VariableExpression:
+				pos, ok := globals[n.Name]
+				if ok && !slices.Contains(fn.Params, n.Name) && !before(pos) && !reported[n.Name] {
+					reported[n.Name] = true
+					c.errorf(call.Pos(), "Function %s uses variable %s, which is not assigned before this call", fn.Name, n.Name)
+				}
+			case *parser.FunctionCallExpression:
+				callee, ok := c.functions[n.Name]
+				switch {
+				case !ok || visited[n.Name]:
+				case !before(callee.EndPos()):
+					if !reported[n.Name+"()"] {
+						reported[n.Name+"()"] = true
+						c.errorf(call.Pos(), "Function %s calls %s, which is not declared before this call", fn.Name, n.Name)
+					}
+				default:
+					visit(callee)
+				}
+			}
+			return true
+		})
+	}
+	visit(c.functions[call.Name])
+}
+
+// constant 计算只由常量组成的算术表达式的值，表达式中含有变量时返回 false
+func constant(expr parser.Expression) (float64, bool) {
+	switch expr := expr.(type) {
+	case *parser.ConstantExpression:
+		val, err := ConstantValue(expr.Value)
+		return val, err == nil
+	case *parser.UnaryExpression:
+		operand, ok := constant(expr.Operand)
+		switch expr.Operator {
+		case token.MINUS:
+			return -operand, ok
+		case token.PLUS:
+			return operand, ok
+		}
+	case *parser.BinaryExpression:
+		left, ok1 := constant(expr.Left)
+		right, ok2 := constant(expr.Right)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		switch expr.Operator {
+		case token.PLUS:
+			return left + right, true
+		case token.MINUS:
+			return left - right, true
+		case token.MUL:
+			return left * right, true
+		case token.DIV:
+			return left / right, true
+		case token.POWER:
+			return math.Pow(left, right), true
+		}
+	case *parser.FunctionCallExpression:
+		fn, ok := builtin.Lookup(expr.Name)
+		if !ok {
+			return 0, false
+		}
+		args := make([]float64, len(expr.Arguments))
+		for k, arg := range expr.Arguments {
+			if args[k], ok = constant(arg); !ok {
+				return 0, false
+			}
+		}
+		result, err := fn.Call(args)
+		return result, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,190 @@
+package semantic
+
+import (
+	"compilers/lexer"
+	"compilers/parser"
+	"reflect"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input       string
+		predeclared []string // 执行之前已经定义的全局变量
+		diagnostics []string
+	}{
+		{
+			input:       "x = a + b;\nFUNC f(t) = t * a;",
+			predeclared: []string{"a"},
+			diagnostics: []string{"1:9: Undefined variable: b"},
+		},
+		{
+			input: "a = 1;\nFUNC f(x) = x * a + b;\nb = 2;\nFOR T FROM 0 TO 2*PI STEP PI/50 DRAW (f(T), SIN(T));",
+		},
+		{
+			input:       "x = y + 1;\nORIGIN IS (x, z);",
+			diagnostics: []string{"1:5: Undefined variable: y", "2:15: Undefined variable: z"},
+		},
+		{
+			// 循环变量和循环体中赋值的变量只在循环内可见
+			input: "FOR T FROM 0 TO 1 STEP 0.5 BEGIN IF T > 0 THEN DRAW (T, s); s = T; END;\nx = T + s;",
+			diagnostics: []string{
+				"2:5: Loop variable T is only visible inside the FOR statement at 1:1",
+				"2:9: Undefined variable: s",
+			},
+		},
+		{
+			// 第一次迭代时循环体中的变量在赋值之前还没有定义，IF 分支中的使用不报告
+			input: "FOR T FROM 0 TO 1 STEP 0.5 BEGIN DRAW (x, T); x = T; END;\n" +
+				"FOR T FROM 0 TO 1 STEP 0.5 BEGIN FOR u FROM 0 TO 1 STEP 1 DRAW (y, u); y = T; IF T > 0 THEN DRAW (z, T); z = T; END;\n" +
+				"FOR T FROM 0 TO 1 STEP 0.5 BEGIN FOR u FROM 0 TO 1 STEP 1 BEGIN w = u; DRAW (w, u); END; DRAW (w, T); w = T; END;",
+			diagnostics: []string{
+				"1:40: Variable x is used before it is assigned in the FOR body",
+				"2:65: Variable y is used before it is assigned in the FOR body",
+				"3:96: Variable w is used before it is assigned in the FOR body",
+			},
+		},
+		{
+			// 嵌套的 FOR 循环体中赋值的变量只在内层循环中可见
+			input:       "FOR T FROM 0 TO 1 STEP 1 BEGIN FOR u FROM 0 TO 1 STEP 1 BEGIN z = u; DRAW (z, T); END; DRAW (z, T); END;",
+			diagnostics: []string{"1:94: Undefined variable: z"},
+		},
+		{
+			// 循环变量不能遮蔽已有的变量，包括外层循环的变量和注入的变量
+			input:       "T = 1;\nFOR T FROM 0 TO 1 STEP 1 DRAW (T, T);\nFOR u FROM 0 TO 1 STEP 1 FOR u FROM 0 TO 1 STEP 1 DRAW (u, u);\nFOR a FROM 0 TO 1 STEP 1 DRAW (a, a);",
+			predeclared: []string{"a"},
+			diagnostics: []string{
+				"2:1: Loop variable T shadows an existing variable",
+				"3:26: Loop variable u shadows an existing variable",
+				"4:1: Loop variable a shadows an existing variable",
+			},
+		},
+		{
+			// 函数体用到的全局变量和函数必须在调用之前已经赋值或声明
+			input:       "FUNC f(x) = x + k; y = f(1); k = 2;",
+			diagnostics: []string{"1:24: Function f uses variable k, which is not assigned before this call"},
+		},
+		{
+			input:       "FUNC f(x) = g(x); y = f(1); FUNC g(x) = x;",
+			diagnostics: []string{"1:23: Function f calls g, which is not declared before this call"},
+		},
+		{
+			// 间接调用的函数同样检查，之后的调用可以使用已经赋值的变量
+			input: "FUNC f(x) = g(x) + 1;\nFUNC g(x) = x * k;\ny = f(1);\nk = f(2);\nk = f(k);",
+			diagnostics: []string{
+				"3:5: Function g uses variable k, which is not assigned before this call",
+				"4:5: Function g uses variable k, which is not assigned before this call",
+			},
+		},
+		{
+			// 函数体只能看到参数和全局变量
+			input:       "FUNC f(x) = x + T;\nFOR T FROM 0 TO 1 STEP 1 DRAW (T, f(T));",
+			diagnostics: []string{"1:17: Loop variable T is only visible inside the FOR statement at 2:1"},
+		},
+		{
+			input: "x = SIN(1, 2) + MAX() + ATAN2(1);\nFUNC f(a, b) = a + b;\ny = f(1);\nz = g(1);",
+			diagnostics: []string{
+				"1:5: Function SIN expects 1 argument(s), got 2",
+				"1:17: Function MAX expects at least 1 argument, got 0",
+				"1:25: Function ATAN2 expects 2 argument(s), got 1",
+				"3:5: Function f expects 2 argument(s), got 1",
+				"4:5: Unknown function: g",
+			},
+		},
+		{
+			input:       "FUNC f(a) = a;\nFUNC f(a, b) = a;",
+			diagnostics: []string{"2:1: Function f already declared at 1:1"},
+		},
+		{
+			input:       "PI = 3;\nIF 1 THEN E = 2;",
+			diagnostics: []string{"1:1: Cannot assign to constant PI", "2:11: Cannot assign to constant E"},
+		},
+		{
+			input: "FOR T FROM 0 TO 1 STEP 0 DRAW (T, T);\n" +
+				"FOR T FROM 0 TO 1 STEP 1 - 1 DRAW (T, T);\n" +
+				"FOR T FROM 0 TO 1 STEP -0.1 DRAW (T, T);\n" +
+				"FOR T FROM 1 TO 0 STEP 0.1 DRAW (T, T);\n" +
+				"FOR T FROM 1 TO 0 STEP -0.1 DRAW (T, T);\n" +
+				"s = 0; FOR T FROM 0 TO 1 STEP s DRAW (T, T);",
+			diagnostics: []string{
+				"1:24: STEP of FOR T is zero, the loop would never end",
+				"2:24: STEP of FOR T is zero, the loop would never end",
+				"3:24: STEP -0.1 of FOR T never reaches 1 from 0",
+				"4:24: STEP 0.1 of FOR T never reaches 0 from 1",
+			},
+		},
+		{
+			input: "FOR T FROM 1 TO 0 STEP ADAPTIVE DRAW (T, T);\n" +
+				"FOR T FROM 0 TO 1 STEP ADAPTIVE TOLERANCE 0 DRAW (T, T);\n" +
+				"FOR T FROM 0 TO 1 STEP ADAPTIVE TOLERANCE -1 DRAW (T, T);",
+			diagnostics: []string{
+				"2:43: TOLERANCE must be a positive number, got 0",
+				"3:43: TOLERANCE must be a positive number, got -1",
+			},
+		},
+		{
+			input: "TRANSFORM IS (1, 0, 0, 1);\nTRANSFORM IS (1, 0, 0, 1, 0, 0);",
+			diagnostics: []string{
+				"1:1: TRANSFORM expects 6 components (a, b, c, d, e, f), got 4",
+			},
+		},
+		{
+			input: "PUSH; ROT IS 1; PUSH; POP;\nFOR T FROM 0 TO 1 STEP 1 BEGIN PUSH; DRAW (T, T); POP; END;\nPOP;",
+		},
+		{
+			input: "POP;\nPUSH;\nPUSH; POP;",
+			diagnostics: []string{
+				"1:1: POP without matching PUSH",
+				"2:1: PUSH without matching POP",
+			},
+		},
+		{
+			// FOR 循环体和 IF 分支中的 PUSH / POP 必须在内部匹配
+			input: "PUSH;\nFOR T FROM 0 TO 1 STEP 1 BEGIN PUSH; DRAW (T, T); END;\nIF 1 THEN POP ELSE BEGIN PUSH; POP; END;\nPOP;",
+			diagnostics: []string{
+				"2:32: PUSH without matching POP",
+				"3:11: POP without matching PUSH",
+			},
+		},
+		{
+			input: "WIDTH IS 0;\nWIDTH IS -1;\nWIDTH IS 1/0;\nWIDTH IS w;\nw = 1; WIDTH IS w*2;",
+			diagnostics: []string{
+				"1:10: WIDTH must be a positive number, got 0",
+				"2:10: WIDTH must be a positive number, got -1",
+				"3:10: WIDTH must be a positive number, got +Inf",
+				"4:10: Undefined variable: w",
+			},
+		},
+		{
+			input: "OUTPUT IS \"\";\nOUTPUT IS \"a.png\";\nOUTPUT IS \"a.svg\";\nOUTPUT IS \"a.gif\";",
+			diagnostics: []string{
+				"1:1: OUTPUT file name is empty",
+				"4:1: Unknown image format \".gif\" of \"a.gif\", expected one of png, svg, pdf, eps, jsonl",
+			},
+		},
+		{
+			input: "FOR T FROM 0 TO 1 STEP 1 BEGIN DRAW (T); DRAW (T, T, T); DRAW (); END;",
+			diagnostics: []string{
+				"1:32: DRAW expects 2 components (x, y), got 1",
+				"1:42: DRAW expects 2 components (x, y), got 3",
+				"1:58: DRAW expects 2 components (x, y), got 0",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			statements, diagnostics := parser.New(lexer.New(tt.input)).ParseProgram()
+			if len(diagnostics) > 0 {
+				t.Fatalf("unexpected parse diagnostics %v", diagnostics)
+			}
+			var got []string
+			for _, d := range Check(statements, tt.predeclared...) {
+				got = append(got, d.Error())
+			}
+			if !reflect.DeepEqual(got, tt.diagnostics) {
+				t.Errorf("expected %q, but got %q", tt.diagnostics, got)
+			}
+		})
+	}
+}
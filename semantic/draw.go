@@ -0,0 +1,182 @@
+package semantic
+
+import (
+	"compilers/render"
+	"math"
+)
+
+// Pen 是 DRAW 语句的画法
+type Pen struct {
+	Lines bool        // 为 true 时把相邻的采样点连成折线，否则每个采样点画一个圆点
+	Width float64     // 折线的线宽，单位为像素
+	Join  render.Join // 折线拐角的样式
+	Cap   render.Cap  // 折线端点的样式
+}
+
+// DefaultPen 是程序开始时的画笔：每个采样点画一个圆点
+var DefaultPen = Pen{Width: 1, Join: render.JoinRound, Cap: render.CapRound}
+
+// pointRadius 是 POINTS 方式下圆点的半径，单位为像素
+const pointRadius = 2
+
+// jumpLimit 返回折线中相邻两点在画布上的最大距离，即画布较长的一边，单位为像素。
+// 超过时认为曲线在两点之间不连续，例如 TAN 的渐近线附近，折线在此断开
+func (s *State) jumpLimit() float64 {
+	return float64(max(s.Width, s.Height))
+}
+
+// jumpRatio 和 jumpMinimum 判断折线中的一段是否是跳变：长于 jumpMinimum 像素，
+// 并且比同一条折线中前后相邻的各段都长 jumpRatio 倍以上，例如 MOD 和 FLOOR 的断点处。
+// 连续曲线上的尖峰由一上一下两段长边组成，每一段都有同样长的邻段，不会被断开
+const (
+	jumpRatio   = 4
+	jumpMinimum = 4
+)
+
+// isJump 判断 device 中第 j 段，即第 j-1 个点到第 j 个点，是否是跳变。没有相邻段的一段不算跳变
+func isJump(device []render.Point, j int) bool {
+	length := segmentLength(device, j)
+	if length <= jumpMinimum {
+		return false
+	}
+	neighbour := -1.0
+	if j > 1 {
+		neighbour = segmentLength(device, j-1)
+	}
+	if j+1 < len(device) {
+		neighbour = max(neighbour, segmentLength(device, j+1))
+	}
+	return neighbour >= 0 && length > jumpRatio*neighbour
+}
+
+// segmentLength 返回 device 中第 j 段的长度
+func segmentLength(device []render.Point, j int) float64 {
+	return math.Hypot(device[j].X-device[j-1].X, device[j].Y-device[j-1].Y)
+}
+
+// curve 是一条正在画的折线
+type curve struct {
+	world  []render.Point
+	device []render.Point
+	style  render.Style
+}
+
+// curveSet 是 FOR 循环的一次执行中各条 DRAW 语句正在画的折线
+type curveSet struct {
+	keys []interface{}          // 按第一次画点的顺序排列的 DRAW 语句
+	open map[interface{}]*curve // 尚未画完的折线
+}
+
+// DrawPoint 按当前的坐标变换和画笔画出 DRAW 语句 key 的一个采样点。
+//
+// 以 LINES 方式画时，同一次 FOR 循环中同一条 DRAW 语句的相邻采样点连成一条折线，
+// 循环结束时画出。采样点或其设备坐标为 NaN 或无穷时跳过该点并断开折线，例如函数参数超出定义域；
+// 相邻两点在画布上的距离超过 jumpLimit，或者一段折线比前后相邻的段长得多 (见 isJump) 时同样断开，
+// 后者要等到下一个点画出或折线结束时才能判断。画笔改变时从上一个点开始一条新的折线。
+// 返回采样点的设备坐标，跳过的点和试探执行时返回 false
+func (s *State) DrawPoint(key interface{}, x, y float64) (render.Point, bool) {
+	if s.probe != nil {
+		transformedX, transformedY := s.TransformPoint(x, y)
+		s.probe.points = append(s.probe.points, render.Point{X: transformedX, Y: transformedY})
+		return render.Point{}, false
+	}
+
+	// Transform the point according to the current state
+	transformedX, transformedY := s.TransformPoint(x, y)
+	world := render.Point{X: x, Y: y}
+	device := render.Point{X: transformedX, Y: transformedY}
+	if !isFinite(world) || !isFinite(device) {
+		// 有限的用户坐标经过坐标变换后也可能溢出为无穷
+		s.endCurve(key)
+		return render.Point{}, false
+	}
+
+	if !s.Pen.Lines {
+		s.endCurve(key)
+		s.DisplayList().Add(&render.PointOp{World: world, Device: device, Radius: pointRadius})
+		return device, true
+	}
+
+	if len(s.loops) == 0 {
+		// 不在 FOR 循环中时只有一个点
+		s.addPolyline(&curve{world: []render.Point{world}, device: []render.Point{device}, style: s.lineStyle()})
+		return device, true
+	}
+	set := s.loops[len(s.loops)-1]
+	c := set.open[key]
+	style := s.lineStyle()
+	if c != nil {
+		last := len(c.device) - 1
+		switch {
+		case math.Hypot(device.X-c.device[last].X, device.Y-c.device[last].Y) > s.jumpLimit():
+			s.endCurve(key)
+			c = nil
+		case c.style != style:
+			// 新的折线从上一个点开始，两条折线之间没有缺口
+			s.endCurve(key)
+			c = &curve{world: []render.Point{c.world[last]}, device: []render.Point{c.device[last]}, style: style}
+			set.add(key, c)
+		}
+	}
+	if c == nil {
+		c = &curve{style: style}
+		set.add(key, c)
+	}
+	c.world = append(c.world, world)
+	c.device = append(c.device, device)
+	if n := len(c.device); n >= 3 && isJump(c.device, n-2) {
+		s.splitCurve(c, n-2)
+	}
+	return device, true
+}
+
+// splitCurve 在第 j 段跳变处断开折线 c：画出前 j 个点，c 只保留其余的点
+func (s *State) splitCurve(c *curve, j int) {
+	s.addPolyline(&curve{world: c.world[:j:j], device: c.device[:j:j], style: c.style})
+	c.world, c.device = c.world[j:], c.device[j:]
+}
+
+// lineStyle 返回当前画笔画折线的样式
+func (s *State) lineStyle() render.Style {
+	return render.Style{Width: s.Pen.Width, Join: s.Pen.Join, Cap: s.Pen.Cap}
+}
+
+// add 开始 DRAW 语句 key 的一条新折线
+func (set *curveSet) add(key interface{}, c *curve) {
+	set.keys = append(set.keys, key)
+	set.open[key] = c
+}
+
+// endCurve 画出 DRAW 语句 key 在最内层 FOR 循环中正在画的折线
+func (s *State) endCurve(key interface{}) {
+	if len(s.loops) == 0 {
+		return
+	}
+	set := s.loops[len(s.loops)-1]
+	if c, ok := set.open[key]; ok {
+		delete(set.open, key)
+		if n := len(c.device); n >= 3 && isJump(c.device, n-1) {
+			s.splitCurve(c, n-1)
+		}
+		s.addPolyline(c)
+	}
+}
+
+// endLoop 在最内层 FOR 循环结束时按顺序画出其中所有的折线
+func (s *State) endLoop() {
+	set := s.loops[len(s.loops)-1]
+	for _, key := range set.keys {
+		s.endCurve(key)
+	}
+	s.loops = s.loops[:len(s.loops)-1]
+}
+
+// addPolyline 把折线加入显示列表，样式改变时先加入一个 StyleOp
+func (s *State) addPolyline(c *curve) {
+	l := s.DisplayList()
+	if c.style != s.style {
+		l.Add(&render.StyleOp{Style: c.style})
+		s.style = c.style
+	}
+	l.Add(&render.PolylineOp{World: c.world, Device: c.device})
+}
@@ -0,0 +1,68 @@
+package semantic
+
+import "math"
+
+// Matrix 是二维仿射变换
+//
+//	x' = A*x + C*y + E
+//	y' = B*x + D*y + F
+//
+// 与 SVG 的 matrix(a, b, c, d, e, f) 含义相同。零值不是单位矩阵，应使用 Identity
+type Matrix struct {
+	A, B, C, D, E, F float64
+}
+
+// Identity 返回单位矩阵
+func Identity() Matrix {
+	return Matrix{A: 1, D: 1}
+}
+
+// Translate 返回平移 (tx, ty) 的变换
+func Translate(tx, ty float64) Matrix {
+	return Matrix{A: 1, D: 1, E: tx, F: ty}
+}
+
+// Scale 返回按 (sx, sy) 缩放的变换
+func Scale(sx, sy float64) Matrix {
+	return Matrix{A: sx, D: sy}
+}
+
+// Rotate 返回绕原点旋转 angle 弧度的变换：
+//
+//	x' = x*cos(angle) + y*sin(angle)
+//	y' = y*cos(angle) - x*sin(angle)
+//
+// 在 y 轴向下的屏幕坐标系中，正角度表示逆时针旋转
+func Rotate(angle float64) Matrix {
+	sin, cos := math.Sincos(angle)
+	return Matrix{A: cos, B: -sin, C: sin, D: cos}
+}
+
+// Shear 返回错切变换 x' = x + kx*y, y' = ky*x + y
+func Shear(kx, ky float64) Matrix {
+	return Matrix{A: 1, B: ky, C: kx, D: 1}
+}
+
+// Reflect 返回以过原点的直线为轴的反射，轴的方向是 x 轴经 Rotate(angle) 旋转后的方向。
+// Reflect(0) 把 (x, y) 映射为 (x, -y)，Reflect(PI/2) 把 (x, y) 映射为 (-x, y)
+func Reflect(angle float64) Matrix {
+	sin, cos := math.Sincos(2 * angle)
+	return Matrix{A: cos, B: -sin, C: -sin, D: -cos}
+}
+
+// Then 返回先做变换 m、再做变换 n 的复合变换
+func (m Matrix) Then(n Matrix) Matrix {
+	return Matrix{
+		A: n.A*m.A + n.C*m.B,
+		B: n.B*m.A + n.D*m.B,
+		C: n.A*m.C + n.C*m.D,
+		D: n.B*m.C + n.D*m.D,
+		E: n.A*m.E + n.C*m.F + n.E,
+		F: n.B*m.E + n.D*m.F + n.F,
+	}
+}
+
+// Apply 对点 (x, y) 做变换
+func (m Matrix) Apply(x, y float64) (float64, float64) {
+	return m.A*x + m.C*y + m.E, m.B*x + m.D*y + m.F
+}
@@ -0,0 +1,181 @@
+package semantic
+
+import (
+	"math"
+	"testing"
+)
+
+// near 判断两个坐标是否在浮点误差范围内相等
+func near(x1, y1, x2, y2 float64) bool {
+	const eps = 1e-9
+	return math.Abs(x1-x2) < eps && math.Abs(y1-y2) < eps
+}
+
+func TestMatrix(t *testing.T) {
+	tests := []struct {
+		name   string
+		m      Matrix
+		x, y   float64
+		ex, ey float64
+	}{
+		{"identity", Identity(), 3, 4, 3, 4},
+		{"translate", Translate(10, -5), 3, 4, 13, -1},
+		{"scale", Scale(2, 3), 3, 4, 6, 12},
+		{"rotate 90", Rotate(math.Pi / 2), 1, 0, 0, -1},
+		{"rotate 90 y", Rotate(math.Pi / 2), 0, 1, 1, 0},
+		{"rotate 180", Rotate(math.Pi), 3, 4, -3, -4},
+		{"shear x", Shear(2, 0), 1, 1, 3, 1},
+		{"shear y", Shear(0, 0.5), 2, 1, 2, 2},
+		{"reflect x axis", Reflect(0), 3, 4, 3, -4},
+		{"reflect y axis", Reflect(math.Pi / 2), 3, 4, -3, 4},
+		{"reflect diagonal", Reflect(-math.Pi / 4), 3, 4, 4, 3},
+		{"svg matrix", Matrix{A: 1, B: 2, C: 3, D: 4, E: 5, F: 6}, 1, 1, 9, 12},
+		// 先缩放再平移，与先平移再缩放的结果不同
+		{"scale then translate", Scale(2, 2).Then(Translate(1, 1)), 3, 4, 7, 9},
+		{"translate then scale", Translate(1, 1).Then(Scale(2, 2)), 3, 4, 8, 10},
+		{"rotate then translate", Rotate(math.Pi / 2).Then(Translate(100, 100)), 1, 0, 100, 99},
+		{"reflect twice", Reflect(0.3).Then(Reflect(0.3)), 3, 4, 3, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, y := tt.m.Apply(tt.x, tt.y)
+			if !near(x, y, tt.ex, tt.ey) {
+				t.Errorf("expected (%v, %v), but got (%v, %v)", tt.ex, tt.ey, x, y)
+			}
+		})
+	}
+}
+
+func TestPopEmpty(t *testing.T) {
+	s := NewState()
+	if s.Pop() {
+		t.Errorf("expected Pop on an empty stack to fail")
+	}
+	s.Push()
+	if !s.Pop() || s.Pop() {
+		t.Errorf("expected exactly one successful Pop after one Push")
+	}
+}
+
+func TestTransformPoint(t *testing.T) {
+	tests := []struct {
+		name   string
+		apply  func(s *State)
+		x, y   float64
+		ex, ey float64
+	}{
+		{
+			name:  "initial state",
+			apply: func(s *State) {},
+			x:     3, y: 4, ex: 3, ey: 4,
+		},
+		{
+			// 替换模式下与语句顺序无关：先缩放，再旋转，最后平移
+			name: "absolute",
+			apply: func(s *State) {
+				s.ApplyOrigin(100, 200)
+				s.ApplyRotation(math.Pi / 2)
+				s.ApplyScale(2, 3)
+			},
+			x: 1, y: 1, ex: 103, ey: 198,
+		},
+		{
+			// 后面的语句替换前面的设置
+			name: "absolute overwrite",
+			apply: func(s *State) {
+				s.ApplyOrigin(100, 200)
+				s.ApplyOrigin(10, 20)
+				s.ApplyScale(5, 5)
+				s.ApplyScale(2, 2)
+			},
+			x: 1, y: 1, ex: 12, ey: 22,
+		},
+		{
+			name: "absolute shear and reflect",
+			apply: func(s *State) {
+				s.ApplyShear(1, 0)
+				s.ApplyReflection(0)
+				s.ApplyScale(2, 2)
+			},
+			x: 1, y: 1, ex: 4, ey: -2,
+		},
+		{
+			// TRANSFORM 最先作用于点
+			name: "absolute transform",
+			apply: func(s *State) {
+				s.ApplyTransform(Matrix{A: 0, B: 1, C: 1, D: 0, E: 1, F: 0})
+				s.ApplyOrigin(10, 10)
+			},
+			x: 2, y: 3, ex: 14, ey: 12,
+		},
+		{
+			// 叠加模式下后面的变换先作用于点：绕 (100, 100) 旋转
+			name: "cumulative",
+			apply: func(s *State) {
+				s.SetCumulative(true)
+				s.ApplyOrigin(100, 100)
+				s.ApplyRotation(math.Pi / 2)
+				s.ApplyScale(2, 2)
+			},
+			x: 1, y: 0, ex: 100, ey: 98,
+		},
+		{
+			name: "cumulative translate twice",
+			apply: func(s *State) {
+				s.SetCumulative(true)
+				s.ApplyOrigin(10, 0)
+				s.ApplyOrigin(0, 10)
+			},
+			x: 1, y: 1, ex: 11, ey: 11,
+		},
+		{
+			// 进入叠加模式时保留当前变换，回到替换模式时恢复各部分组成的变换
+			name: "switch modes",
+			apply: func(s *State) {
+				s.ApplyScale(2, 2)
+				s.SetCumulative(true)
+				s.ApplyOrigin(5, 5)
+				s.SetCumulative(false)
+				s.ApplyOrigin(1, 1)
+			},
+			x: 1, y: 1, ex: 3, ey: 3,
+		},
+		{
+			// POP 恢复 PUSH 时的全部变换，包括叠加模式
+			name: "push pop",
+			apply: func(s *State) {
+				s.ApplyOrigin(10, 10)
+				s.Push()
+				s.ApplyScale(2, 2)
+				s.SetCumulative(true)
+				s.ApplyRotation(1)
+				s.Push()
+				s.ApplyOrigin(5, 5)
+				s.Pop()
+				s.Pop()
+			},
+			x: 1, y: 1, ex: 11, ey: 11,
+		},
+		{
+			name: "switch to cumulative",
+			apply: func(s *State) {
+				s.ApplyScale(2, 2)
+				s.SetCumulative(true)
+				s.ApplyOrigin(5, 5)
+			},
+			x: 1, y: 1, ex: 12, ey: 12,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewState()
+			tt.apply(s)
+			x, y := s.TransformPoint(tt.x, tt.y)
+			if !near(x, y, tt.ex, tt.ey) {
+				t.Errorf("expected (%v, %v), but got (%v, %v)", tt.ex, tt.ey, x, y)
+			}
+		})
+	}
+}
@@ -1,218 +1,305 @@
 package semantic
 
 import (
-	"compilers/parser"
-	"compilers/token"
+	"compilers/render"
 	"fmt"
-	"git.sr.ht/~sbinet/gg"
 	"math"
 )
 
-// State 定义当前坐标系的状态
+// Transform 是坐标变换的全部状态，PUSH / POP 把它与画笔 (Pen) 一起保存和恢复
+//
+// 默认情况下 ORIGIN、SCALE、ROT 等语句各自替换变换中的一个部分，
+// 点 (x, y) 依次经过 TRANSFORM、SCALE、SHEAR、REFLECT、ROT、ORIGIN 得到屏幕坐标，
+// 与语句出现的先后顺序无关。Cumulative 为 true 时每条变换语句都叠加在当前变换上，
+// 新的变换先作用于点，和在画布上依次调用 translate、rotate 的效果相同
+type Transform struct {
+	OriginX  float64 // 原点横坐标
+	OriginY  float64 // 原点纵坐标
+	ScaleX   float64 // 横坐标比例因子
+	ScaleY   float64 // 纵坐标比例因子
+	Rotation float64 // 旋转角度，弧度制
+	ShearX   float64 // 横向错切系数
+	ShearY   float64 // 纵向错切系数
+	Reflect  Matrix  // 最近一次 REFLECT 语句的反射，默认为单位矩阵
+	Custom   Matrix  // TRANSFORM IS 给出的矩阵，最先作用于点，默认为单位矩阵
+
+	Cumulative bool   // 变换语句是否叠加，见 State.SetCumulative
+	matrix     Matrix // 叠加模式下的当前变换
+}
+
+// State 定义一次执行的全部状态：变量、坐标变换、画笔和画布。
+// 各个 State 之间不共享任何可变的数据，不同的 goroutine 可以同时使用不同的 State，
+// 但一个 State 同时只能由一个 goroutine 使用
 type State struct {
-	Variables map[string]float64 // 变量表
-	OriginX   float64            // 原点横坐标
-	OriginY   float64            // 原点纵坐标
-	ScaleX    float64            // 横坐标比例因子
-	ScaleY    float64            // 纵坐标比例因子
-	Rotation  float64            // 旋转角度，弧度制
+	Transform     // 当前的坐标变换
+	Pen       Pen // DRAW 语句的画法
+	Width     int // 画布宽度，单位为像素，第一次 DRAW 之后不再改变
+	Height    int // 画布高度，单位为像素
+
+	globals map[string]float64   // 全局变量表，通过 Define、Assign 和 Lookup 访问
+	stack   []snapshot           // PUSH 保存的坐标变换和画笔
+	scopes  []map[string]float64 // 局部作用域栈，例如 FOR 循环变量
+	canvas  *render.DisplayList  // 整个程序画出的内容，第一次 DRAW 时创建
+	loops   []*curveSet          // 正在执行的各层 FOR 循环中尚未画完的折线
+	style   render.Style         // 显示列表中当前的样式
+	probe   *probe               // 试探执行时记录画出的点，见 Probe
+}
+
+// snapshot 是 PUSH 保存的状态
+type snapshot struct {
+	transform Transform
+	pen       Pen
 }
 
 // NewState 返回一个初始状态
 func NewState() *State {
 	return &State{
-		Variables: make(map[string]float64),
-		OriginX:   0,
-		OriginY:   0,
-		ScaleX:    1,
-		ScaleY:    1,
-		Rotation:  0,
+		globals: make(map[string]float64),
+		Transform: Transform{
+			ScaleX:  1,
+			ScaleY:  1,
+			Reflect: Identity(),
+			Custom:  Identity(),
+			matrix:  Identity(),
+		},
+		Pen:    DefaultPen,
+		Width:  CanvasWidth,
+		Height: CanvasHeight,
+		style:  render.DefaultStyle,
 	}
 }
 
-// ApplyScale 应用 SCALE 语句，修改比例因子
-func (s *State) ApplyScale(xFactor, yFactor float64) {
-	s.ScaleX = xFactor
-	s.ScaleY = yFactor
+// Push 把当前的坐标变换和画笔压入栈中
+func (s *State) Push() {
+	s.stack = append(s.stack, snapshot{s.Transform, s.Pen})
 }
 
-// ApplyOrigin 应用 ORIGIN 语句，修改原点
-func (s *State) ApplyOrigin(x, y float64) {
-	s.OriginX = x
-	s.OriginY = y
+// Pop 恢复最近一次 Push 保存的坐标变换和画笔；栈为空时返回 false
+func (s *State) Pop() bool {
+	if len(s.stack) == 0 {
+		return false
+	}
+	top := s.stack[len(s.stack)-1]
+	s.Transform, s.Pen = top.transform, top.pen
+	s.stack = s.stack[:len(s.stack)-1]
+	return true
 }
 
-// ApplyRotation 应用 ROT 语句，修改旋转角度
-func (s *State) ApplyRotation(angle float64) {
-	s.Rotation = angle
+// PushScope 进入一层新的变量作用域
+func (s *State) PushScope() {
+	s.scopes = append(s.scopes, make(map[string]float64))
 }
 
-// TransformPoint 根据当前的坐标变换状态转换一个点的坐标
-func (s *State) TransformPoint(x, y float64) (float64, float64) {
-	// 先应用缩放
-	x *= s.ScaleX
-	y *= s.ScaleY
-
-	// 计算旋转后的坐标
-	rotX := x*math.Cos(s.Rotation) + y*math.Sin(s.Rotation)
-	rotY := y*math.Cos(s.Rotation) + x*math.Sin(s.Rotation)
+// PopScope 离开最内层作用域，其中定义的变量随之失效
+func (s *State) PopScope() {
+	s.scopes = s.scopes[:len(s.scopes)-1]
+}
 
-	// 最后应用平移（ORIGIN）
-	rotX += s.OriginX
-	rotY += s.OriginY
+// Define 在最内层作用域中绑定变量；没有局部作用域时写入全局变量表
+func (s *State) Define(name string, value float64) {
+	if len(s.scopes) == 0 {
+		s.globals[name] = value
+		return
+	}
+	s.scopes[len(s.scopes)-1][name] = value
+}
 
-	return rotX, rotY
+// Assign 给变量赋值：已绑定的变量在原作用域中更新，否则在最内层作用域中新建
+func (s *State) Assign(name string, value float64) {
+	for i := len(s.scopes) - 1; i >= 0; i-- {
+		if _, ok := s.scopes[i][name]; ok {
+			s.scopes[i][name] = value
+			return
+		}
+	}
+	if _, ok := s.globals[name]; ok {
+		s.globals[name] = value
+		return
+	}
+	s.Define(name, value)
 }
 
-// FunctionCall 对应的函数调用，例如 Sin, Cos 等
-type FunctionCall struct {
-	Name      string
-	Arguments []float64
+// WithFrame 在只包含 bindings 的新调用帧中执行 fn，期间调用者的局部作用域不可见，
+// 全局变量仍然可以访问。返回 fn 的错误
+func (s *State) WithFrame(bindings map[string]float64, fn func() error) error {
+	saved := s.scopes
+	s.scopes = []map[string]float64{bindings}
+	defer func() { s.scopes = saved }()
+	return fn()
 }
 
-// ApplyFunction 应用函数调用（例如 Sin, Cos）
-func (s *State) ApplyFunction(fn string, args []float64) []float64 {
-	var result []float64
-	switch fn {
-	case "Sin":
-		for _, arg := range args {
-			result = append(result, math.Sin(arg))
-		}
-	case "Cos":
-		for _, arg := range args {
-			result = append(result, math.Cos(arg))
-		}
-	case "Tan":
-		for _, arg := range args {
-			result = append(result, math.Tan(arg))
-		}
-	case "Sqrt":
-		for _, arg := range args {
-			result = append(result, math.Sqrt(arg))
-		}
-	case "Exp":
-		for _, arg := range args {
-			result = append(result, math.Exp(arg))
-		}
-	case "Ln":
-		for _, arg := range args {
-			result = append(result, math.Log(arg))
+// Lookup 由内向外查找变量，最后查找全局变量表
+func (s *State) Lookup(name string) (float64, bool) {
+	for i := len(s.scopes) - 1; i >= 0; i-- {
+		if val, ok := s.scopes[i][name]; ok {
+			return val, true
 		}
 	}
-	return result
+	val, ok := s.globals[name]
+	return val, ok
 }
 
-// ForStatement 表示 FOR 循环语句
-type ForStatement struct {
-	LoopVar  string     // 循环变量名
-	Start    float64    // 起点
-	End      float64    // 终点
-	Step     float64    // 步长
-	DrawExpr Expression // 表达式，生成 (横坐标, 纵坐标)
+// ApplyScale 应用 SCALE 语句，修改比例因子
+func (s *State) ApplyScale(xFactor, yFactor float64) {
+	if s.Cumulative {
+		s.compose(Scale(xFactor, yFactor))
+		return
+	}
+	s.ScaleX = xFactor
+	s.ScaleY = yFactor
 }
 
-// Expression 表达式接口，所有表达式实现此接口
-type Expression interface {
-	Evaluate(t float64) []float64 // 计算表达式的值，t 作为动态参数
+// ApplyOrigin 应用 ORIGIN 语句，修改原点
+func (s *State) ApplyOrigin(x, y float64) {
+	if s.Cumulative {
+		s.compose(Translate(x, y))
+		return
+	}
+	s.OriginX = x
+	s.OriginY = y
 }
 
-// ConstantExpression 常量表达式
-type ConstantExpression struct {
-	Value float64
+// ApplyRotation 应用 ROT 语句，修改旋转角度
+func (s *State) ApplyRotation(angle float64) {
+	if s.Cumulative {
+		s.compose(Rotate(angle))
+		return
+	}
+	s.Rotation = angle
 }
 
-// Evaluate 计算常量表达式的值
-func (c *ConstantExpression) Evaluate(t float64) []float64 {
-	return []float64{c.Value}
+// ApplyShear 应用 SHEAR 语句，修改错切系数
+func (s *State) ApplyShear(kx, ky float64) {
+	if s.Cumulative {
+		s.compose(Shear(kx, ky))
+		return
+	}
+	s.ShearX = kx
+	s.ShearY = ky
 }
 
-// BinaryExpression 二元表达式
-type BinaryExpression struct {
-	Left     Expression
-	Operator token.TokenType
-	Right    Expression
+// ApplyReflection 应用 REFLECT 语句，以倾角为 angle 的直线为轴反射
+func (s *State) ApplyReflection(angle float64) {
+	if s.Cumulative {
+		s.compose(Reflect(angle))
+		return
+	}
+	s.Reflect = Reflect(angle)
 }
 
-// Evaluate 计算二元表达式的值
-func (b *BinaryExpression) Evaluate(t float64) []float64 {
-	left := b.Left.Evaluate(t)[0]
-	right := b.Right.Evaluate(t)[0]
-	var result float64
-	switch b.Operator {
-	case token.PLUS:
-		result = left + right
-	case token.MINUS:
-		result = left - right
-	case token.MUL:
-		result = left * right
-	case token.DIV:
-		result = left / right
+// ApplyTransform 应用 TRANSFORM IS 语句
+func (s *State) ApplyTransform(m Matrix) {
+	if s.Cumulative {
+		s.compose(m)
+		return
 	}
-	return []float64{result}
+	s.Custom = m
 }
 
-// FunctionCallExpression 函数调用表达式（例如 Sin(T), Cos(T)）
-type FunctionCallExpression struct {
-	FunctionName string
-	Arguments    []Expression
+// compose 在叠加模式下把 m 叠加到当前变换上，m 先作用于点
+func (s *State) compose(m Matrix) {
+	s.matrix = m.Then(s.matrix)
 }
 
-// Evaluate 计算函数调用的值，t 作为参数传入
-func (f *FunctionCallExpression) Evaluate(t float64) []float64 {
-	var args []float64
-	for _, arg := range f.Arguments {
-		args = append(args, arg.Evaluate(t)[0]) // 获取每个参数的值
+// SetCumulative 切换变换语句的模式。进入叠加模式时以当前的变换为起点；
+// 回到替换模式时恢复为各个部分组成的变换，叠加期间的变化不再起作用
+func (s *State) SetCumulative(cumulative bool) {
+	if cumulative && !s.Cumulative {
+		s.matrix = s.Matrix()
 	}
-
-	// 调用函数
-	return applyFunction(f.FunctionName, args)
+	s.Cumulative = cumulative
 }
 
-// applyFunction 应用函数（例如 Sin, Cos）
-func applyFunction(fn string, args []float64) []float64 {
-	var result []float64
-	switch fn {
-	case "Sin":
-		for _, arg := range args {
-			result = append(result, math.Sin(arg))
-		}
-	case "Cos":
-		for _, arg := range args {
-			result = append(result, math.Cos(arg))
-		}
+// Matrix 返回从用户坐标到屏幕坐标的变换
+func (t *Transform) Matrix() Matrix {
+	if t.Cumulative {
+		return t.matrix
 	}
-	return result
+	return t.Custom.
+		Then(Scale(t.ScaleX, t.ScaleY)).
+		Then(Shear(t.ShearX, t.ShearY)).
+		Then(t.Reflect).
+		Then(Rotate(t.Rotation)).
+		Then(Translate(t.OriginX, t.OriginY))
 }
 
-// ParseForStatement 解析 FOR T FROM 起点 TO 终点 STEP 步长 DRAW (横坐标, 纵坐标)
-func (s *State) ParseForStatement(start, end, step float64, drawExpr parser.Expression) {
-	const width = 800
-	const height = 600
+// TransformPoint 根据当前的坐标变换状态转换一个点的坐标
+func (s *State) TransformPoint(x, y float64) (float64, float64) {
+	return s.Matrix().Apply(x, y)
+}
 
-	// Create a new image context
-	dc := gg.NewContext(width, height)
-	dc.SetRGB(1, 1, 1)
-	dc.Clear()
-	dc.SetRGB(0, 0, 0)
+// 画布默认的大小，单位为像素
+const (
+	CanvasWidth  = 800
+	CanvasHeight = 600
+)
 
-	// Loop from start to end, incrementing by step
-	for t := start; t <= end; t += step {
-		// Evaluate the DRAW expression
-		result := drawExpr.Evaluate(t, s.Variables)
-		x, y := result[0], result[1]
+// stepTolerance 是循环终点的容差，以步长为单位。浮点误差使最后一步稍稍越过终点时仍执行这一步
+const stepTolerance = 1e-9
 
-		// Transform the point according to the current state
-		transformedX, transformedY := s.TransformPoint(x, y)
+// maxIterations 是 LoopCount 能够表示的最大迭代次数，超过时相邻两次迭代的循环变量可能相同
+const maxIterations = 1 << 53
 
-		// Draw the point
-		dc.DrawPoint(transformedX, transformedY, 2)
-		fmt.Println("Drawing point:", transformedX, transformedY)
-		dc.Fill()
+// LoopCount 返回 FOR 变量 FROM start TO end STEP step 的迭代次数。
+// step 为零、与 end - start 方向相反或者参数不是有限数时返回错误；start 等于 end 时只迭代一次
+func LoopCount(loopVar string, start, end, step float64) (int, error) {
+	for _, x := range []float64{start, end, step} {
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return 0, fmt.Errorf("FOR %s FROM %v TO %v STEP %v needs finite numbers", loopVar, start, end, step)
+		}
+	}
+	if step == 0 {
+		return 0, fmt.Errorf("STEP of FOR %s is zero, the loop would never end", loopVar)
 	}
+	steps := (end - start) / step
+	if steps < 0 {
+		return 0, fmt.Errorf("STEP %v of FOR %s never reaches %v from %v", step, loopVar, end, start)
+	}
+	steps = math.Floor(steps + stepTolerance)
+	if steps >= maxIterations {
+		return 0, fmt.Errorf("STEP %v of FOR %s is too small to reach %v from %v", step, loopVar, end, start)
+	}
+	return int(steps) + 1, nil
+}
 
-	// Save the image to a file
-	err := dc.SavePNG("output.png")
+// ParseForStatement 执行 FOR 变量 FROM 起点 TO 终点 STEP 步长 循环体
+// 循环变量只在新的作用域内可见，body 在该作用域中执行每一次迭代，
+// body 返回错误时循环立即结束并返回该错误。
+// 第 k 次迭代时循环变量为 start + k*step，步长的误差不会累积；step 为负时从 start 递减到 end，
+// 最后一次迭代与 end 之差在容差之内时循环变量恰好取 end。参数不合法时返回 LoopCount 的错误。
+// 循环结束时画出这次循环中以 LINES 方式连成的折线
+func (s *State) ParseForStatement(loopVar string, start, end, step float64, body func() error) error {
+	n, err := LoopCount(loopVar, start, end, step)
 	if err != nil {
-		fmt.Println("Failed to save image:", err)
+		return err
+	}
+	s.PushScope()
+	defer s.PopScope()
+	s.loops = append(s.loops, &curveSet{open: make(map[interface{}]*curve)})
+	defer s.endLoop()
+
+	for k := 0; k < n; k++ {
+		t := start + float64(k)*step
+		if k == n-1 && math.Abs(t-end) <= stepTolerance*math.Abs(step) {
+			t = end
+		}
+		s.Define(loopVar, t)
+		if err := body(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Drawn 报告程序是否已经画过点，即画布是否已经创建
+func (s *State) Drawn() bool {
+	return s.canvas != nil
+}
+
+// DisplayList 返回程序到目前为止画出的内容，第一次调用时创建一个空的显示列表
+func (s *State) DisplayList() *render.DisplayList {
+	if s.canvas == nil {
+		s.canvas = render.NewDisplayList(s.Width, s.Height)
 	}
+	return s.canvas
 }
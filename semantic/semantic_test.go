@@ -0,0 +1,93 @@
+package semantic
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// 循环变量由 start + k*step 算出，终点在容差之内时恰好取到
+func TestParseForStatement(t *testing.T) {
+	tests := []struct {
+		start, end, step float64
+		expected         []float64
+	}{
+		{0, 0.3, 0.1, []float64{0, 0.1, 0.2, 0.3}},
+		{0, 1, 0.25, []float64{0, 0.25, 0.5, 0.75, 1}},
+		{1, 0, -0.25, []float64{1, 0.75, 0.5, 0.25, 0}},
+		{0, 1, 0.4, []float64{0, 0.4, 0.8}},
+		{2, 2, 1, []float64{2}},
+		{2, 2, -1, []float64{2}},
+	}
+
+	for _, tt := range tests {
+		var got []float64
+		s := NewState()
+		err := s.ParseForStatement("T", tt.start, tt.end, tt.step, func() error {
+			t, _ := s.Lookup("T")
+			got = append(got, t)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("FROM %v TO %v STEP %v: unexpected error %v", tt.start, tt.end, tt.step, err)
+			continue
+		}
+		// 0.1 的倍数不能精确表示，只比较个数和终点
+		if len(got) != len(tt.expected) || got[len(got)-1] != tt.expected[len(tt.expected)-1] {
+			t.Errorf("FROM %v TO %v STEP %v: expected %v, but got %v", tt.start, tt.end, tt.step, tt.expected, got)
+		}
+	}
+
+	// 一千万次累加 0.1 会错过终点，按 start + k*step 计算则不会
+	n, err := LoopCount("T", 0, 1e6, 0.1)
+	if err != nil || n != 10000001 {
+		t.Errorf("expected 10000001 iterations, but got %d, %v", n, err)
+	}
+}
+
+func TestLoopCount(t *testing.T) {
+	tests := []struct {
+		start, end, step float64
+		err              string
+	}{
+		{0, 1, 0, "STEP of FOR T is zero, the loop would never end"},
+		{0, 1, -0.5, "STEP -0.5 of FOR T never reaches 1 from 0"},
+		{1, 0, 0.5, "STEP 0.5 of FOR T never reaches 0 from 1"},
+		{0, 1e300, 1e-300, "STEP 1e-300 of FOR T is too small to reach 1e+300 from 0"},
+		{0, math.Inf(1), 1, "FOR T FROM 0 TO +Inf STEP 1 needs finite numbers"},
+	}
+
+	for _, tt := range tests {
+		_, err := LoopCount("T", tt.start, tt.end, tt.step)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("expected error %q, but got %v", tt.err, err)
+		}
+	}
+}
+
+// STEP ADAPTIVE 的终点小于起点时参数递减
+func TestParseAdaptiveForStatementDescending(t *testing.T) {
+	var got []float64
+	s := NewState()
+	err := s.ParseAdaptiveForStatement("T", 1, 0, DefaultTolerance, func() error {
+		if !s.Probing() {
+			t, _ := s.Lookup("T")
+			got = append(got, t)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0] != 1 || got[len(got)-1] != 0 {
+		t.Errorf("expected T to run from 1 to 0, but got %v", got)
+	}
+	for k := 1; k < len(got); k++ {
+		if got[k] >= got[k-1] {
+			t.Fatalf("expected T to decrease, but got %v", got)
+		}
+	}
+	if expected := []float64{1, 0.984375}; !reflect.DeepEqual(got[:2], expected) {
+		t.Errorf("expected %v, but got %v", expected, got[:2])
+	}
+}
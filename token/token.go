@@ -1,12 +1,43 @@
 package token
 
+import "fmt"
+
 // TokenType 是标记的类型
 type TokenType string
 
+// Pos 表示源代码中的一个位置
+type Pos struct {
+	Filename string // 文件名，可以为空
+	Offset   int    // 字节偏移量，从 0 开始
+	Line     int    // 行号，从 1 开始
+	Column   int    // 列号（按字节计），从 1 开始
+}
+
+// IsValid 判断位置是否有效
+func (p Pos) IsValid() bool {
+	return p.Line > 0
+}
+
+// String 以 file:line:col 的形式返回位置
+func (p Pos) String() string {
+	if !p.IsValid() {
+		if p.Filename != "" {
+			return p.Filename
+		}
+		return "-"
+	}
+	if p.Filename == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+}
+
 // Token 表示一个词法单元
 type Token struct {
 	Type    TokenType // 标记类型
 	Literal string    // 标记的字面值
+	Start   Pos       // 第一个字符的位置
+	End     Pos       // 最后一个字符之后的位置
 }
 
 // List of token types.
@@ -18,6 +49,7 @@ const (
 	// Identifiers and Literals
 	ID       TokenType = "ID"       // Identifier
 	CONST_ID TokenType = "CONST_ID" // Constant (e.g., numbers)
+	STRING   TokenType = "STRING"   // String literal, e.g. "out.png"; the literal keeps the quotes
 
 	// Operators
 	PLUS   TokenType = "+"
@@ -27,11 +59,21 @@ const (
 	POWER  TokenType = "**"
 	ASSIGN TokenType = "="
 
+	// Comparison Operators
+	LT TokenType = "<"
+	LE TokenType = "<="
+	GT TokenType = ">"
+	GE TokenType = ">="
+	EQ TokenType = "=="
+	NE TokenType = "!="
+
 	// Delimiters
 	COMMA     TokenType = ","
 	SEMICO    TokenType = ";"
 	L_BRACKET TokenType = "("
 	R_BRACKET TokenType = ")"
+	L_BRACE   TokenType = "{"
+	R_BRACE   TokenType = "}"
 
 	// Keywords
 	ORIGIN TokenType = "ORIGIN"
@@ -43,19 +85,84 @@ const (
 	TO     TokenType = "TO"
 	STEP   TokenType = "STEP"
 	DRAW   TokenType = "DRAW"
+	BEGIN  TokenType = "BEGIN"
+	END    TokenType = "END"
+	IF     TokenType = "IF"
+	THEN   TokenType = "THEN"
+	ELSE   TokenType = "ELSE"
+	FUNC   TokenType = "FUNC"
+	OUTPUT TokenType = "OUTPUT"
+
+	// Transform Keywords
+	SHEAR     TokenType = "SHEAR"
+	REFLECT   TokenType = "REFLECT"
+	TRANSFORM TokenType = "TRANSFORM"
+	PUSH      TokenType = "PUSH"
+	POP       TokenType = "POP"
+
+	// Adaptive Sampling Keywords
+	ADAPTIVE  TokenType = "ADAPTIVE"
+	TOLERANCE TokenType = "TOLERANCE"
+
+	// Line Style Keywords
+	WIDTH TokenType = "WIDTH"
+	JOIN  TokenType = "JOIN"
+	CAP   TokenType = "CAP"
+
+	// Logical Operators
+	AND TokenType = "AND"
+	OR  TokenType = "OR"
+	NOT TokenType = "NOT"
 
-	// Mathematical Functions (新增部分)
-	SIN  TokenType = "SIN"
-	COS  TokenType = "COS"
-	TAN  TokenType = "TAN"
-	SQRT TokenType = "SQRT"
-	EXP  TokenType = "EXP"
-	LN   TokenType = "LN"
+	// Mathematical Functions, looked up in the builtin registry
+	BUILTIN TokenType = "BUILTIN" // e.g. SIN, COS; the literal holds the name
 
 	// Comments
 	COMMENT TokenType = "COMMENT"
 )
 
+// keywords 是保留字及其标记类型，PI 和 E 是数学常量
+var keywords = map[string]TokenType{
+	"PI":        CONST_ID,
+	"E":         CONST_ID,
+	"ORIGIN":    ORIGIN,
+	"IS":        IS,
+	"SCALE":     SCALE,
+	"ROT":       ROT,
+	"SHEAR":     SHEAR,
+	"REFLECT":   REFLECT,
+	"TRANSFORM": TRANSFORM,
+	"PUSH":      PUSH,
+	"POP":       POP,
+	"WIDTH":     WIDTH,
+	"JOIN":      JOIN,
+	"CAP":       CAP,
+	"FOR":       FOR,
+	"FROM":      FROM,
+	"TO":        TO,
+	"STEP":      STEP,
+	"ADAPTIVE":  ADAPTIVE,
+	"TOLERANCE": TOLERANCE,
+	"DRAW":      DRAW,
+	"BEGIN":     BEGIN,
+	"END":       END,
+	"IF":        IF,
+	"THEN":      THEN,
+	"ELSE":      ELSE,
+	"FUNC":      FUNC,
+	"OUTPUT":    OUTPUT,
+	"AND":       AND,
+	"OR":        OR,
+	"NOT":       NOT,
+}
+
+// Keyword 返回保留字 ident 的标记类型，ident 不是保留字时返回 false。
+// 词法分析器先按保留字识别标识符，因此保留字不能用作变量名或函数名
+func Keyword(ident string) (TokenType, bool) {
+	tok, ok := keywords[ident]
+	return tok, ok
+}
+
 // New 创建一个新的 Token
 func New(tokenType TokenType, literal string) Token {
 	return Token{